@@ -0,0 +1,99 @@
+// Command record re-records the cassettes replayed by a scraper's tests,
+// running a search in its job portal and saving every request and response.
+//
+//	go run ./cmd/record -scraper LinkedIn -keywords golang -location berlin
+//
+// The query has to match the one of the tests replaying the cassette, and
+// the offers they expect have to be updated to the recorded ones.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape"
+	"github.com/alwedo/jobber/scrape/glassdoor"
+	"github.com/alwedo/jobber/scrape/linkedin"
+	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/alwedo/jobber/scrape/stepstone"
+)
+
+// proxies are the env vars with the proxies of the scrapers that use them.
+var proxies = map[string]string{
+	linkedin.Name:  "LINKEDIN_PROXIES",
+	glassdoor.Name: "GLASSDOOR_PROXIES",
+}
+
+var scrapers = map[string]func(...retryhttp.Option) scrape.Scraper{
+	linkedin.Name:  func(o ...retryhttp.Option) scrape.Scraper { return linkedin.New(linkedin.WithClientOptions(o...)) },
+	stepstone.Name: func(o ...retryhttp.Option) scrape.Scraper { return stepstone.New(stepstone.WithClientOptions(o...)) },
+	glassdoor.Name: func(o ...retryhttp.Option) scrape.Scraper { return glassdoor.New(glassdoor.WithClientOptions(o...)) },
+}
+
+func main() {
+	var (
+		name     = flag.String("scraper", "", "name of the scraper, ie. LinkedIn, Stepstone or Glassdoor")
+		keywords = flag.String("keywords", "golang", "keywords of the search")
+		location = flag.String("location", "berlin", "location of the search")
+		pages    = flag.Int("pages", 3, "max result pages to record")
+		out      = flag.String("out", "", "cassette file (default scrape/<scraper>/test_data/cassette.json)")
+	)
+	flag.Parse()
+
+	if err := record(*name, *keywords, *location, *pages, *out); err != nil {
+		slog.Error("unable to record cassette", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func record(name, keywords, location string, pages int, out string) error {
+	newScraper, ok := scrapers[name]
+	if !ok {
+		return fmt.Errorf("unknown scraper %q", name)
+	}
+	if out == "" {
+		out = filepath.Join("scrape", strings.ToLower(name), "test_data", "cassette.json")
+	}
+
+	var pool *retryhttp.ProxyPool
+	if key, ok := proxies[name]; ok {
+		var err error
+		if pool, err = retryhttp.ProxyPoolFromEnv(key); err != nil {
+			return err
+		}
+	}
+	cas, err := retryhttp.NewCassette(out, retryhttp.ModeRecord)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var page, offers int
+	for o, err := range newScraper(retryhttp.WithProxyPool(pool), retryhttp.WithCassette(cas)).Scrape(ctx, &db.GetQueryScraperRow{
+		Keywords: keywords,
+		Location: location,
+	}) {
+		if err != nil {
+			return fmt.Errorf("scrape failed after %d pages: %w", page, err)
+		}
+		page++
+		offers += len(o)
+		if page >= pages {
+			break
+		}
+	}
+
+	if err := cas.Save(); err != nil {
+		return err
+	}
+	slog.Info("cassette recorded", slog.String("file", out), slog.Int("pages", page), slog.Int("offers", offers))
+	return nil
+}
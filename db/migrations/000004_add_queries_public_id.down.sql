@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_queries_public_id;
+
+ALTER TABLE queries
+DROP COLUMN IF EXISTS public_id;
@@ -0,0 +1,4 @@
+ALTER TABLE queries
+ADD COLUMN public_id UUID NOT NULL DEFAULT gen_random_uuid();
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_queries_public_id ON queries (public_id);
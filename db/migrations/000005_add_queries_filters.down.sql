@@ -0,0 +1,20 @@
+BEGIN;
+
+-- Filtered queries can't be told apart without their filters, and dropping
+-- them would break their subscribers' feeds, so they're never deleted here.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM queries WHERE exclude_keywords <> '{}' OR title_include <> '{}' OR title_exclude <> '{}') THEN
+        RAISE EXCEPTION 'queries with filters would be lost, delete them before migrating down';
+    END IF;
+END $$;
+
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_keywords_location_filters_key;
+ALTER TABLE queries ADD CONSTRAINT queries_keywords_location_key UNIQUE (keywords, location);
+
+ALTER TABLE queries
+DROP COLUMN IF EXISTS exclude_keywords,
+DROP COLUMN IF EXISTS title_include,
+DROP COLUMN IF EXISTS title_exclude;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE queries
+ADD COLUMN exclude_keywords TEXT[] NOT NULL DEFAULT '{}', -- Terms that discard an offer when found in its title, company or description.
+ADD COLUMN title_include TEXT[] NOT NULL DEFAULT '{}', -- At least one of these terms must be in the offer title.
+ADD COLUMN title_exclude TEXT[] NOT NULL DEFAULT '{}'; -- Terms that discard an offer when found in its title.
+
+-- The same search with different filters is a different feed.
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_keywords_location_key;
+ALTER TABLE queries ADD CONSTRAINT queries_keywords_location_filters_key UNIQUE (keywords, location, exclude_keywords, title_include, title_exclude);
+
+COMMIT;
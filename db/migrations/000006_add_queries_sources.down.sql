@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Queries with selected sources can't be told apart without them, and
+-- dropping them would break their subscribers' feeds, so they're never
+-- deleted here.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM queries WHERE sources <> '{}') THEN
+        RAISE EXCEPTION 'queries with sources would be lost, delete them before migrating down';
+    END IF;
+END $$;
+
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_keywords_location_filters_key;
+ALTER TABLE queries ADD CONSTRAINT queries_keywords_location_filters_key UNIQUE (keywords, location, exclude_keywords, title_include, title_exclude);
+
+ALTER TABLE queries
+DROP COLUMN IF EXISTS sources;
+
+COMMIT;
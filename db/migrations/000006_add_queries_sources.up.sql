@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE queries
+ADD COLUMN sources TEXT[] NOT NULL DEFAULT '{}'; -- Scrapers the query runs against. Empty means all of them.
+
+-- The same search against different sources is a different feed.
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_keywords_location_filters_key;
+ALTER TABLE queries ADD CONSTRAINT queries_keywords_location_filters_key UNIQUE (keywords, location, exclude_keywords, title_include, title_exclude, sources);
+
+COMMIT;
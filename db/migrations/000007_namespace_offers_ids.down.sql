@@ -0,0 +1,33 @@
+BEGIN;
+
+ALTER TABLE query_offers DROP CONSTRAINT IF EXISTS query_offers_offer_id_fkey;
+ALTER TABLE query_offers DROP CONSTRAINT IF EXISTS query_offers_pkey;
+
+-- Bare ids can't tell portals apart, only one offer of each collision is kept.
+DELETE FROM offers o
+USING offers dup
+WHERE o.external_id = dup.external_id
+  AND o.id > dup.id;
+
+ALTER TABLE query_offers ADD COLUMN external_id TEXT;
+
+UPDATE query_offers qo
+SET external_id = o.external_id
+FROM offers o
+WHERE o.id = qo.offer_id;
+
+DELETE FROM query_offers WHERE external_id IS NULL;
+
+ALTER TABLE query_offers DROP COLUMN offer_id;
+ALTER TABLE query_offers RENAME COLUMN external_id TO offer_id;
+ALTER TABLE query_offers ALTER COLUMN offer_id SET NOT NULL;
+
+ALTER TABLE offers DROP CONSTRAINT IF EXISTS offers_source_external_id_key;
+ALTER TABLE offers DROP COLUMN id;
+ALTER TABLE offers RENAME COLUMN external_id TO id;
+ALTER TABLE offers ADD PRIMARY KEY (id);
+
+ALTER TABLE query_offers ADD PRIMARY KEY (query_id, offer_id);
+ALTER TABLE query_offers ADD FOREIGN KEY (offer_id) REFERENCES offers (id) ON DELETE CASCADE;
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Offer ids are only unique within a job portal, so offers are identified
+-- by (source, external_id) and referenced by a surrogate key.
+ALTER TABLE query_offers DROP CONSTRAINT IF EXISTS query_offers_offer_id_fkey;
+ALTER TABLE query_offers DROP CONSTRAINT IF EXISTS query_offers_pkey;
+
+ALTER TABLE offers DROP CONSTRAINT IF EXISTS offers_pkey;
+ALTER TABLE offers RENAME COLUMN id TO external_id;
+ALTER TABLE offers ADD COLUMN id BIGSERIAL PRIMARY KEY;
+ALTER TABLE offers ADD CONSTRAINT offers_source_external_id_key UNIQUE (source, external_id);
+
+ALTER TABLE query_offers RENAME COLUMN offer_id TO external_id;
+ALTER TABLE query_offers ADD COLUMN offer_id BIGINT;
+
+UPDATE query_offers qo
+SET offer_id = o.id
+FROM offers o
+WHERE o.external_id = qo.external_id;
+
+-- Associations to offers that no longer exist were dangling already.
+DELETE FROM query_offers WHERE offer_id IS NULL;
+
+ALTER TABLE query_offers DROP COLUMN external_id;
+ALTER TABLE query_offers ALTER COLUMN offer_id SET NOT NULL;
+ALTER TABLE query_offers ADD PRIMARY KEY (query_id, offer_id);
+ALTER TABLE query_offers ADD FOREIGN KEY (offer_id) REFERENCES offers (id) ON DELETE CASCADE;
+
+COMMIT;
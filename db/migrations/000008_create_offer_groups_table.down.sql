@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE offers DROP COLUMN IF EXISTS group_id;
+
+DROP TABLE IF EXISTS offer_groups CASCADE;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Offer groups hold the same offer published in different job portals.
+CREATE TABLE IF NOT EXISTS offer_groups (
+    id BIGSERIAL PRIMARY KEY,
+    fingerprint TEXT NOT NULL, -- Hash of the normalized title, company and city of the offers.
+    posted_at TIMESTAMPTZ NOT NULL, -- Posting date of the first offer in the group.
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_groups_fingerprint_posted_at ON offer_groups (fingerprint, posted_at);
+
+-- Existing offers are grouped the next time they are scraped.
+ALTER TABLE offers ADD COLUMN group_id BIGINT REFERENCES offer_groups (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_offers_group_id ON offers (group_id);
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Revisions are the only record of what offers looked like before they
+-- changed, so they're never dropped with rows in them.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM offer_revisions) THEN
+        RAISE EXCEPTION 'offer revisions would be lost, delete them before migrating down';
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS offer_revisions CASCADE;
+
+ALTER TABLE offers
+DROP COLUMN IF EXISTS first_seen_at,
+DROP COLUMN IF EXISTS last_seen_at,
+DROP COLUMN IF EXISTS updated_at;
+
+COMMIT;
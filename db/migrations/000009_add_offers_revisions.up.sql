@@ -0,0 +1,27 @@
+BEGIN;
+
+ALTER TABLE offers
+ADD COLUMN first_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Last time a scraper returned the offer.
+ADD COLUMN updated_at TIMESTAMPTZ; -- Last time any of the offer fields changed.
+
+UPDATE offers SET first_seen_at = created_at, last_seen_at = created_at;
+
+-- Revisions keep the previous values of an offer when any of its fields change.
+CREATE TABLE IF NOT EXISTS offer_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    offer_id BIGINT NOT NULL,
+    fields TEXT[] NOT NULL, -- Names of the fields that changed.
+    title TEXT NOT NULL,
+    company TEXT NOT NULL,
+    location TEXT NOT NULL,
+    posted_at TIMESTAMPTZ NOT NULL,
+    description TEXT NOT NULL,
+    url TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (offer_id) REFERENCES offers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_revisions_offer_id ON offer_revisions (offer_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE offers
+DROP COLUMN IF EXISTS checked_at,
+DROP COLUMN IF EXISTS closed_at;
+
+ALTER TABLE query_offers DROP COLUMN IF EXISTS last_seen_at;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Last time each query's scraper returned the offer.
+ALTER TABLE query_offers ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE offers
+ADD COLUMN checked_at TIMESTAMPTZ, -- Last time the offer page was checked.
+ADD COLUMN closed_at TIMESTAMPTZ; -- When the offer was found taken down from the job portal.
+
+CREATE INDEX IF NOT EXISTS idx_offers_checked_at ON offers (checked_at NULLS FIRST) WHERE closed_at IS NULL;
+
+COMMIT;
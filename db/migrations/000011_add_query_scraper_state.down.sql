@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE query_scraper_status
+DROP COLUMN IF EXISTS state,
+DROP COLUMN IF EXISTS offer_count,
+DROP COLUMN IF EXISTS failure_reason,
+DROP COLUMN IF EXISTS state_updated_at;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- State of the last run of each query's scraper, reported while the offers arrive.
+ALTER TABLE query_scraper_status
+ADD COLUMN state TEXT NOT NULL DEFAULT 'pending', -- One of pending, running, done or failed.
+ADD COLUMN offer_count INTEGER NOT NULL DEFAULT 0, -- Offers saved by the last run so far.
+ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '', -- Why the last run failed, fit to show to users.
+ADD COLUMN state_updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Leases of the scheduled jobs, so only one of the instances
+-- sharing the database runs a given job at a time.
+CREATE TABLE IF NOT EXISTS job_locks (
+    key TEXT PRIMARY KEY, -- The job's name, ie. query-1-LinkedIn.
+    token UUID NOT NULL, -- Identifies the holder of the lease to release it.
+    locked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMPTZ NOT NULL
+);
+
+COMMIT;
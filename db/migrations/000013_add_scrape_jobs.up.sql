@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Work queue of the scrapes, one job per query's scraper. Workers claim
+-- due jobs and reschedule them after running, so the schedule survives
+-- restarts and is shared by every instance.
+CREATE TABLE IF NOT EXISTS scrape_jobs (
+    query_id BIGINT NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    scraper_name TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0, -- Due jobs with higher priority run first.
+    next_run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0, -- Consecutive failed runs.
+    last_error TEXT NOT NULL DEFAULT '',
+    locked_until TIMESTAMPTZ, -- Lease of the worker running the job.
+    PRIMARY KEY (query_id, scraper_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrape_jobs_next_run_at ON scrape_jobs (next_run_at);
+
+COMMIT;
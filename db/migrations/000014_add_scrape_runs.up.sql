@@ -0,0 +1,20 @@
+BEGIN;
+
+-- History of every run of the queries' scrapers, to tell what happened
+-- when a feed isn't showing the offers its users expect.
+CREATE TABLE IF NOT EXISTS scrape_runs (
+    id BIGSERIAL PRIMARY KEY,
+    query_id BIGINT NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    scraper_name TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0, -- Pages of results fetched.
+    offers INTEGER NOT NULL DEFAULT 0, -- Offers returned by the job portal.
+    new_offers INTEGER NOT NULL DEFAULT 0, -- Offers seen for the first time.
+    http_statuses TEXT NOT NULL DEFAULT '', -- Responses by status code, ie. '200: 3, 429: 1'.
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_query_id_started_at ON scrape_runs (query_id, started_at DESC);
+
+COMMIT;
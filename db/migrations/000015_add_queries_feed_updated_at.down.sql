@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE queries DROP COLUMN IF EXISTS feed_updated_at;
+
+COMMIT;
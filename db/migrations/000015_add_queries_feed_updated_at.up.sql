@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Last time the offers listed by the query's feeds changed, which unlike
+-- updated_at also changes when its offers are closed or deleted.
+ALTER TABLE queries ADD COLUMN feed_updated_at TIMESTAMPTZ;
+
+UPDATE queries SET feed_updated_at = updated_at;
+
+COMMIT;
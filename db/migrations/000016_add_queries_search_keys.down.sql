@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_search_key;
+ALTER TABLE queries ADD CONSTRAINT queries_keywords_location_filters_key UNIQUE (keywords, location, exclude_keywords, title_include, title_exclude, sources);
+
+ALTER TABLE queries
+DROP COLUMN IF EXISTS keywords_key,
+DROP COLUMN IF EXISTS location_key;
+
+COMMIT;
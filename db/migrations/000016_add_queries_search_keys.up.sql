@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Case folded keywords and location telling which searches are the same,
+-- ie. "Straße" and "strasse", while the ones typed are used to search.
+ALTER TABLE queries
+ADD COLUMN keywords_key TEXT,
+ADD COLUMN location_key TEXT;
+
+-- Existing searches were stored case folded already.
+UPDATE queries SET keywords_key = keywords, location_key = location;
+
+ALTER TABLE queries
+ALTER COLUMN keywords_key SET NOT NULL,
+ALTER COLUMN location_key SET NOT NULL;
+
+ALTER TABLE queries DROP CONSTRAINT IF EXISTS queries_keywords_location_filters_key;
+ALTER TABLE queries ADD CONSTRAINT queries_search_key UNIQUE (keywords_key, location_key, exclude_keywords, title_include, title_exclude, sources);
+
+COMMIT;
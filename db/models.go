@@ -8,8 +8,15 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type JobLock struct {
+	Key         string
+	Token       pgtype.UUID
+	LockedAt    pgtype.Timestamptz
+	LockedUntil pgtype.Timestamptz
+}
+
 type Offer struct {
-	ID          string
+	ExternalID  string
 	Title       string
 	Company     string
 	Location    string
@@ -18,24 +25,87 @@ type Offer struct {
 	Source      string
 	Url         string
 	Description string
+	ID          int64
+	GroupID     pgtype.Int8
+	FirstSeenAt pgtype.Timestamptz
+	LastSeenAt  pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+	CheckedAt   pgtype.Timestamptz
+	ClosedAt    pgtype.Timestamptz
+}
+
+type OfferGroup struct {
+	ID          int64
+	Fingerprint string
+	PostedAt    pgtype.Timestamptz
+	CreatedAt   pgtype.Timestamptz
+}
+
+type OfferRevision struct {
+	ID          int64
+	OfferID     int64
+	Fields      []string
+	Title       string
+	Company     string
+	Location    string
+	PostedAt    pgtype.Timestamptz
+	Description string
+	Url         string
+	CreatedAt   pgtype.Timestamptz
 }
 
 type Query struct {
-	ID        int64
-	Keywords  string
-	Location  string
-	CreatedAt pgtype.Timestamptz
-	QueriedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
+	ID              int64
+	Keywords        string
+	Location        string
+	CreatedAt       pgtype.Timestamptz
+	QueriedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	PublicID        pgtype.UUID
+	ExcludeKeywords []string
+	TitleInclude    []string
+	TitleExclude    []string
+	Sources         []string
+	FeedUpdatedAt   pgtype.Timestamptz
+	KeywordsKey     string
+	LocationKey     string
 }
 
 type QueryOffer struct {
-	QueryID int64
-	OfferID string
+	QueryID    int64
+	OfferID    int64
+	LastSeenAt pgtype.Timestamptz
 }
 
 type QueryScraperStatus struct {
+	QueryID        int64
+	ScraperName    string
+	ScrapedAt      pgtype.Timestamptz
+	State          string
+	OfferCount     int32
+	FailureReason  string
+	StateUpdatedAt pgtype.Timestamptz
+}
+
+type ScrapeJob struct {
 	QueryID     int64
 	ScraperName string
-	ScrapedAt   pgtype.Timestamptz
+	Priority    int32
+	NextRunAt   pgtype.Timestamptz
+	Attempts    int32
+	LastError   string
+	LockedUntil pgtype.Timestamptz
+}
+
+type ScrapeRun struct {
+	ID           int64
+	QueryID      int64
+	ScraperName  string
+	StartedAt    pgtype.Timestamptz
+	FinishedAt   pgtype.Timestamptz
+	Pages        int32
+	Offers       int32
+	NewOffers    int32
+	HttpStatuses string
+	Error        string
 }
@@ -1,8 +1,18 @@
 -- name: CreateQuery :one
+-- The search keys default to the keywords and location themselves.
 INSERT INTO
-    queries (keywords, location)
+    queries (keywords, location, keywords_key, location_key, exclude_keywords, title_include, title_exclude, sources)
 VALUES
-    ($1, $2) RETURNING *;
+    (
+        sqlc.arg(keywords),
+        sqlc.arg(location),
+        COALESCE(sqlc.narg(keywords_key), sqlc.arg(keywords)),
+        COALESCE(sqlc.narg(location_key), sqlc.arg(location)),
+        COALESCE(sqlc.narg(exclude_keywords)::TEXT[], '{}'),
+        COALESCE(sqlc.narg(title_include)::TEXT[], '{}'),
+        COALESCE(sqlc.narg(title_exclude)::TEXT[], '{}'),
+        COALESCE(sqlc.narg(sources)::TEXT[], '{}')
+    ) RETURNING *;
 
 -- name: ListQueries :many
 SELECT
@@ -16,8 +26,32 @@ SELECT
 FROM
     queries
 WHERE
-    keywords = $1
-    AND location = $2;
+    keywords_key = sqlc.arg(keywords_key)
+    AND location_key = sqlc.arg(location_key)
+    AND exclude_keywords = COALESCE(sqlc.narg(exclude_keywords)::TEXT[], '{}')
+    AND title_include = COALESCE(sqlc.narg(title_include)::TEXT[], '{}')
+    AND title_exclude = COALESCE(sqlc.narg(title_exclude)::TEXT[], '{}')
+    AND sources = COALESCE(sqlc.narg(sources)::TEXT[], '{}');
+
+-- name: GetQueryByPublicID :one
+SELECT
+    *
+FROM
+    queries
+WHERE
+    public_id = $1;
+
+-- name: GetQueryVersion :one
+SELECT
+    id,
+    created_at,
+    queried_at,
+    updated_at,
+    feed_updated_at
+FROM
+    queries
+WHERE
+    public_id = $1;
 
 -- name: GetQueryByID :one
 SELECT
@@ -42,14 +76,99 @@ WHERE
 -- name: UpdateQueryUAT :exec
 UPDATE queries
 SET
-    updated_at = CURRENT_TIMESTAMP
+    updated_at = CURRENT_TIMESTAMP,
+    feed_updated_at = CURRENT_TIMESTAMP
 WHERE
     id = $1;
 
--- name: CreateOffer :exec
-INSERT INTO offers (id, title, company, location, posted_at, description, source, url)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-ON CONFLICT (id) DO NOTHING;
+-- name: CreateOffer :batchone
+-- Offers are upserted returning their previous values, if any, so changes
+-- can be recorded. Posting dates less than a day apart are the same one
+-- since some portals only give the age in days of their offers.
+WITH upserted AS (
+    INSERT INTO offers (external_id, title, company, location, posted_at, description, source, url)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    ON CONFLICT (source, external_id) DO UPDATE SET
+        title = EXCLUDED.title,
+        company = EXCLUDED.company,
+        location = EXCLUDED.location,
+        posted_at = CASE
+            WHEN EXCLUDED.posted_at > offers.posted_at - INTERVAL '1 day'
+             AND EXCLUDED.posted_at < offers.posted_at + INTERVAL '1 day' THEN offers.posted_at
+            ELSE EXCLUDED.posted_at
+        END,
+        description = EXCLUDED.description,
+        url = EXCLUDED.url,
+        last_seen_at = CURRENT_TIMESTAMP,
+        closed_at = NULL
+    RETURNING id, group_id
+),
+previous AS (
+    SELECT id, title, company, location, posted_at, description, url
+    FROM offers
+    WHERE external_id = $1
+      AND source = $7
+)
+SELECT
+    u.id,
+    u.group_id,
+    p.title AS previous_title,
+    p.company AS previous_company,
+    p.location AS previous_location,
+    p.posted_at AS previous_posted_at,
+    p.description AS previous_description,
+    p.url AS previous_url
+FROM upserted u
+LEFT JOIN previous p ON p.id = u.id;
+
+-- name: CreateOfferRevision :batchexec
+-- Revisions keep the previous values of an offer whose fields changed.
+WITH revision AS (
+    INSERT INTO offer_revisions (offer_id, fields, title, company, location, posted_at, description, url)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+)
+UPDATE offers
+SET updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ListOfferRevisions :many
+SELECT
+    *
+FROM
+    offer_revisions
+WHERE
+    offer_id = $1
+ORDER BY
+    id DESC;
+
+-- name: AssignOfferGroup :batchexec
+-- Offers join the oldest group with the same fingerprint
+-- posted within 3 days of them that has no offer from their
+-- source yet, or start a new one.
+WITH existing AS (
+    SELECT id
+    FROM offer_groups
+    WHERE fingerprint = sqlc.arg(fingerprint)
+      AND posted_at BETWEEN sqlc.arg(posted_at)::TIMESTAMPTZ - INTERVAL '3 days'
+                        AND sqlc.arg(posted_at)::TIMESTAMPTZ + INTERVAL '3 days'
+      AND NOT EXISTS (
+          SELECT 1
+          FROM offers o
+          WHERE o.group_id = offer_groups.id
+            AND o.source = (SELECT source FROM offers WHERE id = sqlc.arg(id))
+      )
+    ORDER BY id
+    LIMIT 1
+),
+created AS (
+    INSERT INTO offer_groups (fingerprint, posted_at)
+    SELECT sqlc.arg(fingerprint), sqlc.arg(posted_at)
+    WHERE NOT EXISTS (SELECT 1 FROM existing)
+    RETURNING id
+)
+UPDATE offers
+SET group_id = COALESCE((SELECT id FROM existing), (SELECT id FROM created))
+WHERE offers.id = sqlc.arg(id);
 
 -- name: ListOffers :many
 SELECT
@@ -60,17 +179,104 @@ FROM
     JOIN offers o ON qo.offer_id = o.id
 WHERE
     q.id = $1
+    AND o.closed_at IS NULL
 ORDER BY
     o.posted_at DESC;
 
--- name: CreateQueryOfferAssoc :exec
+-- name: ListOffersPage :many
+-- Pages through every offer of the query as stored, closed ones included,
+-- optionally from the given sources only. Pages are ordered by id, so the
+-- next page starts after the last id of the previous one.
+SELECT
+    o.*
+FROM
+    query_offers qo
+    JOIN offers o ON qo.offer_id = o.id
+WHERE
+    qo.query_id = sqlc.arg(query_id)
+    AND o.id > sqlc.arg(after)
+    AND (
+        COALESCE(CARDINALITY(sqlc.narg(sources)::TEXT[]), 0) = 0
+        OR o.source = ANY(sqlc.narg(sources)::TEXT[])
+    )
+ORDER BY
+    o.id
+LIMIT
+    sqlc.arg(page_size);
+
+-- name: CreateQueryOfferAssoc :batchexec
 INSERT INTO query_offers (query_id, offer_id)
 VALUES ($1, $2)
-ON CONFLICT (query_id, offer_id) DO NOTHING;
+ON CONFLICT (query_id, offer_id) DO UPDATE SET last_seen_at = CURRENT_TIMESTAMP;
 
 -- name: DeleteOldOffers :exec
-DELETE FROM offers
-WHERE posted_at < NOW() - INTERVAL '7 days';
+-- Deleting open offers changes the feeds listing them, so their queries
+-- get a new feed update time.
+WITH deleted AS (
+    DELETE FROM offers
+    WHERE posted_at < NOW() - INTERVAL '7 days'
+       OR closed_at < NOW() - INTERVAL '1 day'
+    RETURNING id, closed_at
+)
+UPDATE queries
+SET feed_updated_at = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT qo.query_id
+    FROM query_offers qo
+    JOIN deleted d ON qo.offer_id = d.id
+    WHERE d.closed_at IS NULL
+);
+
+-- name: ListOffersToCheck :many
+-- Offers no query has seen in a day are checked at most once a day,
+-- the ones checked longest ago first.
+SELECT
+    o.id,
+    o.source,
+    o.url
+FROM
+    offers o
+    JOIN query_offers qo ON qo.offer_id = o.id
+WHERE
+    o.closed_at IS NULL
+    AND (o.checked_at IS NULL OR o.checked_at < NOW() - INTERVAL '1 day')
+GROUP BY
+    o.id
+HAVING
+    MAX(qo.last_seen_at) < NOW() - INTERVAL '1 day'
+ORDER BY
+    o.checked_at NULLS FIRST,
+    o.id
+LIMIT $1;
+
+-- name: UpdateOfferCheckedAt :exec
+-- Closed offers are hidden from the feeds and deleted sooner, so the
+-- queries listing them get a new feed update time.
+WITH checked AS (
+    UPDATE offers
+    SET
+        checked_at = CURRENT_TIMESTAMP,
+        closed_at = CASE WHEN sqlc.arg(closed)::BOOLEAN THEN CURRENT_TIMESTAMP END
+    WHERE
+        id = sqlc.arg(id)
+    RETURNING id, closed_at
+)
+UPDATE queries
+SET feed_updated_at = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT qo.query_id
+    FROM query_offers qo
+    JOIN checked c ON qo.offer_id = c.id
+    WHERE c.closed_at IS NOT NULL
+);
+
+-- name: DeleteOrphanOfferGroups :exec
+DELETE FROM offer_groups g
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM offers o
+    WHERE o.group_id = g.id
+);
 
 -- name: GetQueryScraper :one
 WITH q AS (
@@ -112,3 +318,129 @@ UPDATE query_scraper_status
 SET scraped_at = CURRENT_TIMESTAMP
 WHERE query_id = $1
   AND scraper_name = $2;
+
+-- name: UpdateQueryScraperState :exec
+UPDATE query_scraper_status
+SET
+    state = $3,
+    offer_count = $4,
+    failure_reason = $5,
+    state_updated_at = CURRENT_TIMESTAMP
+WHERE query_id = $1
+  AND scraper_name = $2;
+
+-- name: ListQueryScraperStatus :many
+SELECT
+    *
+FROM
+    query_scraper_status
+WHERE
+    query_id = $1
+ORDER BY
+    scraper_name;
+
+-- name: AcquireJobLock :one
+-- Takes the job's lease unless another holder's one hasn't expired yet,
+-- in which case no rows are returned.
+INSERT INTO job_locks (key, token, locked_until)
+VALUES (sqlc.arg(key), gen_random_uuid(), CURRENT_TIMESTAMP + sqlc.arg(ttl)::INTERVAL)
+ON CONFLICT (key) DO UPDATE
+SET
+    token = EXCLUDED.token,
+    locked_at = EXCLUDED.locked_at,
+    locked_until = EXCLUDED.locked_until
+WHERE job_locks.locked_until < CURRENT_TIMESTAMP
+RETURNING token;
+
+-- name: ReleaseJobLock :exec
+-- Leases are kept for at least min_hold, so instances whose clocks are
+-- slightly off don't run a job again right after another finished it.
+UPDATE job_locks
+SET locked_until = GREATEST(CURRENT_TIMESTAMP, locked_at + sqlc.arg(min_hold)::INTERVAL)
+WHERE key = sqlc.arg(key)
+  AND token = sqlc.arg(token);
+
+-- name: DeleteExpiredJobLocks :exec
+DELETE FROM job_locks
+WHERE locked_until < NOW() - INTERVAL '1 day';
+
+-- name: EnqueueScrapeJob :batchexec
+-- Adds a query's scraper to the work queue. Jobs already queued keep their schedule.
+INSERT INTO scrape_jobs (query_id, scraper_name, priority, next_run_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (query_id, scraper_name) DO NOTHING;
+
+-- name: CountScrapeJobs :one
+SELECT COUNT(*)
+FROM scrape_jobs
+WHERE query_id = $1;
+
+-- name: ClaimScrapeJob :one
+-- Leases the most urgent due job no other worker is running, skipping the
+-- given scrapers. Jobs whose worker died are claimed again once their
+-- lease expires.
+UPDATE scrape_jobs
+SET locked_until = CURRENT_TIMESTAMP + sqlc.arg(lease)::INTERVAL
+WHERE (query_id, scraper_name) = (
+    SELECT query_id, scraper_name
+    FROM scrape_jobs
+    WHERE next_run_at <= CURRENT_TIMESTAMP
+      AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+      AND scraper_name <> ALL(COALESCE(sqlc.arg(skip)::TEXT[], '{}'))
+    ORDER BY priority DESC, next_run_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: FinishScrapeJob :exec
+-- Releases a claimed job with its next run. It's a no-op if the lease
+-- expired and another worker claimed the job meanwhile.
+UPDATE scrape_jobs
+SET
+    next_run_at = $3,
+    attempts = $4,
+    last_error = $5,
+    priority = 0,
+    locked_until = NULL
+WHERE query_id = $1
+  AND scraper_name = $2
+  AND locked_until = sqlc.arg(locked_until);
+
+-- name: ListScrapeJobs :many
+SELECT
+    *
+FROM
+    scrape_jobs
+WHERE
+    query_id = $1
+ORDER BY
+    scraper_name;
+
+-- name: CreateScrapeRun :exec
+INSERT INTO scrape_runs (
+    query_id,
+    scraper_name,
+    started_at,
+    finished_at,
+    pages,
+    offers,
+    new_offers,
+    http_statuses,
+    error
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: ListScrapeRuns :many
+SELECT
+    *
+FROM
+    scrape_runs
+WHERE
+    query_id = $1
+ORDER BY
+    started_at DESC
+LIMIT $2;
+
+-- name: DeleteOldScrapeRuns :exec
+DELETE FROM scrape_runs
+WHERE started_at < NOW() - INTERVAL '7 days';
@@ -11,51 +11,123 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const createOffer = `-- name: CreateOffer :exec
-INSERT INTO offers (id, title, company, location, posted_at, description, source, url)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-ON CONFLICT (id) DO NOTHING
+const acquireJobLock = `-- name: AcquireJobLock :one
+INSERT INTO job_locks (key, token, locked_until)
+VALUES ($1, gen_random_uuid(), CURRENT_TIMESTAMP + $2::INTERVAL)
+ON CONFLICT (key) DO UPDATE
+SET
+    token = EXCLUDED.token,
+    locked_at = EXCLUDED.locked_at,
+    locked_until = EXCLUDED.locked_until
+WHERE job_locks.locked_until < CURRENT_TIMESTAMP
+RETURNING token
 `
 
-type CreateOfferParams struct {
-	ID          string
-	Title       string
-	Company     string
-	Location    string
-	PostedAt    pgtype.Timestamptz
-	Description string
-	Source      string
-	Url         string
-}
-
-func (q *Queries) CreateOffer(ctx context.Context, arg *CreateOfferParams) error {
-	_, err := q.db.Exec(ctx, createOffer,
-		arg.ID,
-		arg.Title,
-		arg.Company,
-		arg.Location,
-		arg.PostedAt,
-		arg.Description,
-		arg.Source,
-		arg.Url,
+type AcquireJobLockParams struct {
+	Key string
+	Ttl pgtype.Interval
+}
+
+// Takes the job's lease unless another holder's one hasn't expired yet,
+// in which case no rows are returned.
+func (q *Queries) AcquireJobLock(ctx context.Context, arg *AcquireJobLockParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, acquireJobLock, arg.Key, arg.Ttl)
+	var token pgtype.UUID
+	err := row.Scan(&token)
+	return token, err
+}
+
+const claimScrapeJob = `-- name: ClaimScrapeJob :one
+UPDATE scrape_jobs
+SET locked_until = CURRENT_TIMESTAMP + $1::INTERVAL
+WHERE (query_id, scraper_name) = (
+    SELECT query_id, scraper_name
+    FROM scrape_jobs
+    WHERE next_run_at <= CURRENT_TIMESTAMP
+      AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+      AND scraper_name <> ALL(COALESCE($2::TEXT[], '{}'))
+    ORDER BY priority DESC, next_run_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING query_id, scraper_name, priority, next_run_at, attempts, last_error, locked_until
+`
+
+type ClaimScrapeJobParams struct {
+	Lease pgtype.Interval
+	Skip  []string
+}
+
+// Leases the most urgent due job no other worker is running, skipping the
+// given scrapers. Jobs whose worker died are claimed again once their
+// lease expires.
+func (q *Queries) ClaimScrapeJob(ctx context.Context, arg *ClaimScrapeJobParams) (*ScrapeJob, error) {
+	row := q.db.QueryRow(ctx, claimScrapeJob, arg.Lease, arg.Skip)
+	var i ScrapeJob
+	err := row.Scan(
+		&i.QueryID,
+		&i.ScraperName,
+		&i.Priority,
+		&i.NextRunAt,
+		&i.Attempts,
+		&i.LastError,
+		&i.LockedUntil,
 	)
-	return err
+	return &i, err
+}
+
+const countScrapeJobs = `-- name: CountScrapeJobs :one
+SELECT COUNT(*)
+FROM scrape_jobs
+WHERE query_id = $1
+`
+
+func (q *Queries) CountScrapeJobs(ctx context.Context, queryID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countScrapeJobs, queryID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
 }
 
 const createQuery = `-- name: CreateQuery :one
 INSERT INTO
-    queries (keywords, location)
+    queries (keywords, location, keywords_key, location_key, exclude_keywords, title_include, title_exclude, sources)
 VALUES
-    ($1, $2) RETURNING id, keywords, location, created_at, queried_at, updated_at
+    (
+        $1,
+        $2,
+        COALESCE($3, $1),
+        COALESCE($4, $2),
+        COALESCE($5::TEXT[], '{}'),
+        COALESCE($6::TEXT[], '{}'),
+        COALESCE($7::TEXT[], '{}'),
+        COALESCE($8::TEXT[], '{}')
+    ) RETURNING id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
 `
 
 type CreateQueryParams struct {
-	Keywords string
-	Location string
+	Keywords        string
+	Location        string
+	KeywordsKey     pgtype.Text
+	LocationKey     pgtype.Text
+	ExcludeKeywords []string
+	TitleInclude    []string
+	TitleExclude    []string
+	Sources         []string
 }
 
+// The search keys default to the keywords and location themselves.
 func (q *Queries) CreateQuery(ctx context.Context, arg *CreateQueryParams) (*Query, error) {
-	row := q.db.QueryRow(ctx, createQuery, arg.Keywords, arg.Location)
+	row := q.db.QueryRow(ctx, createQuery,
+		arg.Keywords,
+		arg.Location,
+		arg.KeywordsKey,
+		arg.LocationKey,
+		arg.ExcludeKeywords,
+		arg.TitleInclude,
+		arg.TitleExclude,
+		arg.Sources,
+	)
 	var i Query
 	err := row.Scan(
 		&i.ID,
@@ -64,36 +136,117 @@ func (q *Queries) CreateQuery(ctx context.Context, arg *CreateQueryParams) (*Que
 		&i.CreatedAt,
 		&i.QueriedAt,
 		&i.UpdatedAt,
+		&i.PublicID,
+		&i.ExcludeKeywords,
+		&i.TitleInclude,
+		&i.TitleExclude,
+		&i.Sources,
+		&i.FeedUpdatedAt,
+		&i.KeywordsKey,
+		&i.LocationKey,
 	)
 	return &i, err
 }
 
-const createQueryOfferAssoc = `-- name: CreateQueryOfferAssoc :exec
-INSERT INTO query_offers (query_id, offer_id)
-VALUES ($1, $2)
-ON CONFLICT (query_id, offer_id) DO NOTHING
+const createScrapeRun = `-- name: CreateScrapeRun :exec
+INSERT INTO scrape_runs (
+    query_id,
+    scraper_name,
+    started_at,
+    finished_at,
+    pages,
+    offers,
+    new_offers,
+    http_statuses,
+    error
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 `
 
-type CreateQueryOfferAssocParams struct {
-	QueryID int64
-	OfferID string
+type CreateScrapeRunParams struct {
+	QueryID      int64
+	ScraperName  string
+	StartedAt    pgtype.Timestamptz
+	FinishedAt   pgtype.Timestamptz
+	Pages        int32
+	Offers       int32
+	NewOffers    int32
+	HttpStatuses string
+	Error        string
 }
 
-func (q *Queries) CreateQueryOfferAssoc(ctx context.Context, arg *CreateQueryOfferAssocParams) error {
-	_, err := q.db.Exec(ctx, createQueryOfferAssoc, arg.QueryID, arg.OfferID)
+func (q *Queries) CreateScrapeRun(ctx context.Context, arg *CreateScrapeRunParams) error {
+	_, err := q.db.Exec(ctx, createScrapeRun,
+		arg.QueryID,
+		arg.ScraperName,
+		arg.StartedAt,
+		arg.FinishedAt,
+		arg.Pages,
+		arg.Offers,
+		arg.NewOffers,
+		arg.HttpStatuses,
+		arg.Error,
+	)
+	return err
+}
+
+const deleteExpiredJobLocks = `-- name: DeleteExpiredJobLocks :exec
+DELETE FROM job_locks
+WHERE locked_until < NOW() - INTERVAL '1 day'
+`
+
+func (q *Queries) DeleteExpiredJobLocks(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredJobLocks)
 	return err
 }
 
 const deleteOldOffers = `-- name: DeleteOldOffers :exec
-DELETE FROM offers
-WHERE posted_at < NOW() - INTERVAL '7 days'
+WITH deleted AS (
+    DELETE FROM offers
+    WHERE posted_at < NOW() - INTERVAL '7 days'
+       OR closed_at < NOW() - INTERVAL '1 day'
+    RETURNING id, closed_at
+)
+UPDATE queries
+SET feed_updated_at = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT qo.query_id
+    FROM query_offers qo
+    JOIN deleted d ON qo.offer_id = d.id
+    WHERE d.closed_at IS NULL
+)
 `
 
+// Deleting open offers changes the feeds listing them, so their queries
+// get a new feed update time.
 func (q *Queries) DeleteOldOffers(ctx context.Context) error {
 	_, err := q.db.Exec(ctx, deleteOldOffers)
 	return err
 }
 
+const deleteOldScrapeRuns = `-- name: DeleteOldScrapeRuns :exec
+DELETE FROM scrape_runs
+WHERE started_at < NOW() - INTERVAL '7 days'
+`
+
+func (q *Queries) DeleteOldScrapeRuns(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteOldScrapeRuns)
+	return err
+}
+
+const deleteOrphanOfferGroups = `-- name: DeleteOrphanOfferGroups :exec
+DELETE FROM offer_groups g
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM offers o
+    WHERE o.group_id = g.id
+)
+`
+
+func (q *Queries) DeleteOrphanOfferGroups(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteOrphanOfferGroups)
+	return err
+}
+
 const deleteQuery = `-- name: DeleteQuery :exec
 DELETE FROM queries
 WHERE
@@ -105,23 +258,74 @@ func (q *Queries) DeleteQuery(ctx context.Context, id int64) error {
 	return err
 }
 
+const finishScrapeJob = `-- name: FinishScrapeJob :exec
+UPDATE scrape_jobs
+SET
+    next_run_at = $3,
+    attempts = $4,
+    last_error = $5,
+    priority = 0,
+    locked_until = NULL
+WHERE query_id = $1
+  AND scraper_name = $2
+  AND locked_until = $6
+`
+
+type FinishScrapeJobParams struct {
+	QueryID     int64
+	ScraperName string
+	NextRunAt   pgtype.Timestamptz
+	Attempts    int32
+	LastError   string
+	LockedUntil pgtype.Timestamptz
+}
+
+// Releases a claimed job with its next run. It's a no-op if the lease
+// expired and another worker claimed the job meanwhile.
+func (q *Queries) FinishScrapeJob(ctx context.Context, arg *FinishScrapeJobParams) error {
+	_, err := q.db.Exec(ctx, finishScrapeJob,
+		arg.QueryID,
+		arg.ScraperName,
+		arg.NextRunAt,
+		arg.Attempts,
+		arg.LastError,
+		arg.LockedUntil,
+	)
+	return err
+}
+
 const getQuery = `-- name: GetQuery :one
 SELECT
-    id, keywords, location, created_at, queried_at, updated_at
+    id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
 FROM
     queries
 WHERE
-    keywords = $1
-    AND location = $2
+    keywords_key = $1
+    AND location_key = $2
+    AND exclude_keywords = COALESCE($3::TEXT[], '{}')
+    AND title_include = COALESCE($4::TEXT[], '{}')
+    AND title_exclude = COALESCE($5::TEXT[], '{}')
+    AND sources = COALESCE($6::TEXT[], '{}')
 `
 
 type GetQueryParams struct {
-	Keywords string
-	Location string
+	KeywordsKey     string
+	LocationKey     string
+	ExcludeKeywords []string
+	TitleInclude    []string
+	TitleExclude    []string
+	Sources         []string
 }
 
 func (q *Queries) GetQuery(ctx context.Context, arg *GetQueryParams) (*Query, error) {
-	row := q.db.QueryRow(ctx, getQuery, arg.Keywords, arg.Location)
+	row := q.db.QueryRow(ctx, getQuery,
+		arg.KeywordsKey,
+		arg.LocationKey,
+		arg.ExcludeKeywords,
+		arg.TitleInclude,
+		arg.TitleExclude,
+		arg.Sources,
+	)
 	var i Query
 	err := row.Scan(
 		&i.ID,
@@ -130,13 +334,21 @@ func (q *Queries) GetQuery(ctx context.Context, arg *GetQueryParams) (*Query, er
 		&i.CreatedAt,
 		&i.QueriedAt,
 		&i.UpdatedAt,
+		&i.PublicID,
+		&i.ExcludeKeywords,
+		&i.TitleInclude,
+		&i.TitleExclude,
+		&i.Sources,
+		&i.FeedUpdatedAt,
+		&i.KeywordsKey,
+		&i.LocationKey,
 	)
 	return &i, err
 }
 
 const getQueryByID = `-- name: GetQueryByID :one
 SELECT
-    id, keywords, location, created_at, queried_at, updated_at
+    id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
 FROM
     queries
 WHERE
@@ -153,13 +365,52 @@ func (q *Queries) GetQueryByID(ctx context.Context, id int64) (*Query, error) {
 		&i.CreatedAt,
 		&i.QueriedAt,
 		&i.UpdatedAt,
+		&i.PublicID,
+		&i.ExcludeKeywords,
+		&i.TitleInclude,
+		&i.TitleExclude,
+		&i.Sources,
+		&i.FeedUpdatedAt,
+		&i.KeywordsKey,
+		&i.LocationKey,
+	)
+	return &i, err
+}
+
+const getQueryByPublicID = `-- name: GetQueryByPublicID :one
+SELECT
+    id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
+FROM
+    queries
+WHERE
+    public_id = $1
+`
+
+func (q *Queries) GetQueryByPublicID(ctx context.Context, publicID pgtype.UUID) (*Query, error) {
+	row := q.db.QueryRow(ctx, getQueryByPublicID, publicID)
+	var i Query
+	err := row.Scan(
+		&i.ID,
+		&i.Keywords,
+		&i.Location,
+		&i.CreatedAt,
+		&i.QueriedAt,
+		&i.UpdatedAt,
+		&i.PublicID,
+		&i.ExcludeKeywords,
+		&i.TitleInclude,
+		&i.TitleExclude,
+		&i.Sources,
+		&i.FeedUpdatedAt,
+		&i.KeywordsKey,
+		&i.LocationKey,
 	)
 	return &i, err
 }
 
 const getQueryScraper = `-- name: GetQueryScraper :one
 WITH q AS (
-    SELECT id, keywords, location, created_at, queried_at, updated_at
+    SELECT id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
     FROM queries
     WHERE id = $1
 ),
@@ -187,7 +438,7 @@ s AS (
     FROM ins
 )
 SELECT
-    q.id, q.keywords, q.location, q.created_at, q.queried_at, q.updated_at,
+    q.id, q.keywords, q.location, q.created_at, q.queried_at, q.updated_at, q.public_id, q.exclude_keywords, q.title_include, q.title_exclude, q.sources, q.feed_updated_at, q.keywords_key, q.location_key,
     s.scraped_at
 FROM q
 JOIN s ON s.query_id = q.id
@@ -199,13 +450,21 @@ type GetQueryScraperParams struct {
 }
 
 type GetQueryScraperRow struct {
-	ID        int64
-	Keywords  string
-	Location  string
-	CreatedAt pgtype.Timestamptz
-	QueriedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
-	ScrapedAt pgtype.Timestamptz
+	ID              int64
+	Keywords        string
+	Location        string
+	CreatedAt       pgtype.Timestamptz
+	QueriedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	PublicID        pgtype.UUID
+	ExcludeKeywords []string
+	TitleInclude    []string
+	TitleExclude    []string
+	Sources         []string
+	FeedUpdatedAt   pgtype.Timestamptz
+	KeywordsKey     string
+	LocationKey     string
+	ScrapedAt       pgtype.Timestamptz
 }
 
 func (q *Queries) GetQueryScraper(ctx context.Context, arg *GetQueryScraperParams) (*GetQueryScraperRow, error) {
@@ -218,20 +477,105 @@ func (q *Queries) GetQueryScraper(ctx context.Context, arg *GetQueryScraperParam
 		&i.CreatedAt,
 		&i.QueriedAt,
 		&i.UpdatedAt,
+		&i.PublicID,
+		&i.ExcludeKeywords,
+		&i.TitleInclude,
+		&i.TitleExclude,
+		&i.Sources,
+		&i.FeedUpdatedAt,
+		&i.KeywordsKey,
+		&i.LocationKey,
 		&i.ScrapedAt,
 	)
 	return &i, err
 }
 
+const getQueryVersion = `-- name: GetQueryVersion :one
+SELECT
+    id,
+    created_at,
+    queried_at,
+    updated_at,
+    feed_updated_at
+FROM
+    queries
+WHERE
+    public_id = $1
+`
+
+type GetQueryVersionRow struct {
+	ID            int64
+	CreatedAt     pgtype.Timestamptz
+	QueriedAt     pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
+	FeedUpdatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) GetQueryVersion(ctx context.Context, publicID pgtype.UUID) (*GetQueryVersionRow, error) {
+	row := q.db.QueryRow(ctx, getQueryVersion, publicID)
+	var i GetQueryVersionRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.QueriedAt,
+		&i.UpdatedAt,
+		&i.FeedUpdatedAt,
+	)
+	return &i, err
+}
+
+const listOfferRevisions = `-- name: ListOfferRevisions :many
+SELECT
+    id, offer_id, fields, title, company, location, posted_at, description, url, created_at
+FROM
+    offer_revisions
+WHERE
+    offer_id = $1
+ORDER BY
+    id DESC
+`
+
+func (q *Queries) ListOfferRevisions(ctx context.Context, offerID int64) ([]*OfferRevision, error) {
+	rows, err := q.db.Query(ctx, listOfferRevisions, offerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*OfferRevision
+	for rows.Next() {
+		var i OfferRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.OfferID,
+			&i.Fields,
+			&i.Title,
+			&i.Company,
+			&i.Location,
+			&i.PostedAt,
+			&i.Description,
+			&i.Url,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listOffers = `-- name: ListOffers :many
 SELECT
-    o.id, o.title, o.company, o.location, o.posted_at, o.created_at, o.source, o.url, o.description
+    o.external_id, o.title, o.company, o.location, o.posted_at, o.created_at, o.source, o.url, o.description, o.id, o.group_id, o.first_seen_at, o.last_seen_at, o.updated_at, o.checked_at, o.closed_at
 FROM
     queries q
     JOIN query_offers qo ON q.id = qo.query_id
     JOIN offers o ON qo.offer_id = o.id
 WHERE
     q.id = $1
+    AND o.closed_at IS NULL
 ORDER BY
     o.posted_at DESC
 `
@@ -246,7 +590,78 @@ func (q *Queries) ListOffers(ctx context.Context, id int64) ([]*Offer, error) {
 	for rows.Next() {
 		var i Offer
 		if err := rows.Scan(
+			&i.ExternalID,
+			&i.Title,
+			&i.Company,
+			&i.Location,
+			&i.PostedAt,
+			&i.CreatedAt,
+			&i.Source,
+			&i.Url,
+			&i.Description,
 			&i.ID,
+			&i.GroupID,
+			&i.FirstSeenAt,
+			&i.LastSeenAt,
+			&i.UpdatedAt,
+			&i.CheckedAt,
+			&i.ClosedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOffersPage = `-- name: ListOffersPage :many
+SELECT
+    o.external_id, o.title, o.company, o.location, o.posted_at, o.created_at, o.source, o.url, o.description, o.id, o.group_id, o.first_seen_at, o.last_seen_at, o.updated_at, o.checked_at, o.closed_at
+FROM
+    query_offers qo
+    JOIN offers o ON qo.offer_id = o.id
+WHERE
+    qo.query_id = $1
+    AND o.id > $2
+    AND (
+        COALESCE(CARDINALITY($3::TEXT[]), 0) = 0
+        OR o.source = ANY($3::TEXT[])
+    )
+ORDER BY
+    o.id
+LIMIT
+    $4
+`
+
+type ListOffersPageParams struct {
+	QueryID  int64
+	After    int64
+	Sources  []string
+	PageSize int32
+}
+
+// Pages through every offer of the query as stored, closed ones included,
+// optionally from the given sources only. Pages are ordered by id, so the
+// next page starts after the last id of the previous one.
+func (q *Queries) ListOffersPage(ctx context.Context, arg *ListOffersPageParams) ([]*Offer, error) {
+	rows, err := q.db.Query(ctx, listOffersPage,
+		arg.QueryID,
+		arg.After,
+		arg.Sources,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Offer
+	for rows.Next() {
+		var i Offer
+		if err := rows.Scan(
+			&i.ExternalID,
 			&i.Title,
 			&i.Company,
 			&i.Location,
@@ -255,6 +670,13 @@ func (q *Queries) ListOffers(ctx context.Context, id int64) ([]*Offer, error) {
 			&i.Source,
 			&i.Url,
 			&i.Description,
+			&i.ID,
+			&i.GroupID,
+			&i.FirstSeenAt,
+			&i.LastSeenAt,
+			&i.UpdatedAt,
+			&i.CheckedAt,
+			&i.ClosedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -266,9 +688,58 @@ func (q *Queries) ListOffers(ctx context.Context, id int64) ([]*Offer, error) {
 	return items, nil
 }
 
+const listOffersToCheck = `-- name: ListOffersToCheck :many
+SELECT
+    o.id,
+    o.source,
+    o.url
+FROM
+    offers o
+    JOIN query_offers qo ON qo.offer_id = o.id
+WHERE
+    o.closed_at IS NULL
+    AND (o.checked_at IS NULL OR o.checked_at < NOW() - INTERVAL '1 day')
+GROUP BY
+    o.id
+HAVING
+    MAX(qo.last_seen_at) < NOW() - INTERVAL '1 day'
+ORDER BY
+    o.checked_at NULLS FIRST,
+    o.id
+LIMIT $1
+`
+
+type ListOffersToCheckRow struct {
+	ID     int64
+	Source string
+	Url    string
+}
+
+// Offers no query has seen in a day are checked at most once a day,
+// the ones checked longest ago first.
+func (q *Queries) ListOffersToCheck(ctx context.Context, limit int32) ([]*ListOffersToCheckRow, error) {
+	rows, err := q.db.Query(ctx, listOffersToCheck, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*ListOffersToCheckRow
+	for rows.Next() {
+		var i ListOffersToCheckRow
+		if err := rows.Scan(&i.ID, &i.Source, &i.Url); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listQueries = `-- name: ListQueries :many
 SELECT
-    id, keywords, location, created_at, queried_at, updated_at
+    id, keywords, location, created_at, queried_at, updated_at, public_id, exclude_keywords, title_include, title_exclude, sources, feed_updated_at, keywords_key, location_key
 FROM
     queries
 `
@@ -289,6 +760,140 @@ func (q *Queries) ListQueries(ctx context.Context) ([]*Query, error) {
 			&i.CreatedAt,
 			&i.QueriedAt,
 			&i.UpdatedAt,
+			&i.PublicID,
+			&i.ExcludeKeywords,
+			&i.TitleInclude,
+			&i.TitleExclude,
+			&i.Sources,
+			&i.FeedUpdatedAt,
+			&i.KeywordsKey,
+			&i.LocationKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listQueryScraperStatus = `-- name: ListQueryScraperStatus :many
+SELECT
+    query_id, scraper_name, scraped_at, state, offer_count, failure_reason, state_updated_at
+FROM
+    query_scraper_status
+WHERE
+    query_id = $1
+ORDER BY
+    scraper_name
+`
+
+func (q *Queries) ListQueryScraperStatus(ctx context.Context, queryID int64) ([]*QueryScraperStatus, error) {
+	rows, err := q.db.Query(ctx, listQueryScraperStatus, queryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*QueryScraperStatus
+	for rows.Next() {
+		var i QueryScraperStatus
+		if err := rows.Scan(
+			&i.QueryID,
+			&i.ScraperName,
+			&i.ScrapedAt,
+			&i.State,
+			&i.OfferCount,
+			&i.FailureReason,
+			&i.StateUpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScrapeJobs = `-- name: ListScrapeJobs :many
+SELECT
+    query_id, scraper_name, priority, next_run_at, attempts, last_error, locked_until
+FROM
+    scrape_jobs
+WHERE
+    query_id = $1
+ORDER BY
+    scraper_name
+`
+
+func (q *Queries) ListScrapeJobs(ctx context.Context, queryID int64) ([]*ScrapeJob, error) {
+	rows, err := q.db.Query(ctx, listScrapeJobs, queryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*ScrapeJob
+	for rows.Next() {
+		var i ScrapeJob
+		if err := rows.Scan(
+			&i.QueryID,
+			&i.ScraperName,
+			&i.Priority,
+			&i.NextRunAt,
+			&i.Attempts,
+			&i.LastError,
+			&i.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScrapeRuns = `-- name: ListScrapeRuns :many
+SELECT
+    id, query_id, scraper_name, started_at, finished_at, pages, offers, new_offers, http_statuses, error
+FROM
+    scrape_runs
+WHERE
+    query_id = $1
+ORDER BY
+    started_at DESC
+LIMIT $2
+`
+
+type ListScrapeRunsParams struct {
+	QueryID int64
+	Limit   int32
+}
+
+func (q *Queries) ListScrapeRuns(ctx context.Context, arg *ListScrapeRunsParams) ([]*ScrapeRun, error) {
+	rows, err := q.db.Query(ctx, listScrapeRuns, arg.QueryID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*ScrapeRun
+	for rows.Next() {
+		var i ScrapeRun
+		if err := rows.Scan(
+			&i.ID,
+			&i.QueryID,
+			&i.ScraperName,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Pages,
+			&i.Offers,
+			&i.NewOffers,
+			&i.HttpStatuses,
+			&i.Error,
 		); err != nil {
 			return nil, err
 		}
@@ -300,6 +905,58 @@ func (q *Queries) ListQueries(ctx context.Context) ([]*Query, error) {
 	return items, nil
 }
 
+const releaseJobLock = `-- name: ReleaseJobLock :exec
+UPDATE job_locks
+SET locked_until = GREATEST(CURRENT_TIMESTAMP, locked_at + $1::INTERVAL)
+WHERE key = $2
+  AND token = $3
+`
+
+type ReleaseJobLockParams struct {
+	MinHold pgtype.Interval
+	Key     string
+	Token   pgtype.UUID
+}
+
+// Leases are kept for at least min_hold, so instances whose clocks are
+// slightly off don't run a job again right after another finished it.
+func (q *Queries) ReleaseJobLock(ctx context.Context, arg *ReleaseJobLockParams) error {
+	_, err := q.db.Exec(ctx, releaseJobLock, arg.MinHold, arg.Key, arg.Token)
+	return err
+}
+
+const updateOfferCheckedAt = `-- name: UpdateOfferCheckedAt :exec
+WITH checked AS (
+    UPDATE offers
+    SET
+        checked_at = CURRENT_TIMESTAMP,
+        closed_at = CASE WHEN $1::BOOLEAN THEN CURRENT_TIMESTAMP END
+    WHERE
+        id = $2
+    RETURNING id, closed_at
+)
+UPDATE queries
+SET feed_updated_at = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT qo.query_id
+    FROM query_offers qo
+    JOIN checked c ON qo.offer_id = c.id
+    WHERE c.closed_at IS NOT NULL
+)
+`
+
+type UpdateOfferCheckedAtParams struct {
+	Closed bool
+	ID     int64
+}
+
+// Closed offers are hidden from the feeds and deleted sooner, so the
+// queries listing them get a new feed update time.
+func (q *Queries) UpdateOfferCheckedAt(ctx context.Context, arg *UpdateOfferCheckedAtParams) error {
+	_, err := q.db.Exec(ctx, updateOfferCheckedAt, arg.Closed, arg.ID)
+	return err
+}
+
 const updateQueryQAT = `-- name: UpdateQueryQAT :exec
 UPDATE queries
 SET
@@ -330,10 +987,41 @@ func (q *Queries) UpdateQueryScrapedAt(ctx context.Context, arg *UpdateQueryScra
 	return err
 }
 
+const updateQueryScraperState = `-- name: UpdateQueryScraperState :exec
+UPDATE query_scraper_status
+SET
+    state = $3,
+    offer_count = $4,
+    failure_reason = $5,
+    state_updated_at = CURRENT_TIMESTAMP
+WHERE query_id = $1
+  AND scraper_name = $2
+`
+
+type UpdateQueryScraperStateParams struct {
+	QueryID       int64
+	ScraperName   string
+	State         string
+	OfferCount    int32
+	FailureReason string
+}
+
+func (q *Queries) UpdateQueryScraperState(ctx context.Context, arg *UpdateQueryScraperStateParams) error {
+	_, err := q.db.Exec(ctx, updateQueryScraperState,
+		arg.QueryID,
+		arg.ScraperName,
+		arg.State,
+		arg.OfferCount,
+		arg.FailureReason,
+	)
+	return err
+}
+
 const updateQueryUAT = `-- name: UpdateQueryUAT :exec
 UPDATE queries
 SET
-    updated_at = CURRENT_TIMESTAMP
+    updated_at = CURRENT_TIMESTAMP,
+    feed_updated_at = CURRENT_TIMESTAMP
 WHERE
     id = $1
 `
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNoTx = errors.New("connection doesn't support transactions")
+
+// InTx runs fn with the queries bound to a transaction, which is committed
+// if fn succeeds and rolled back otherwise. Queries already bound to a
+// transaction run fn in a savepoint.
+func (q *Queries) InTx(ctx context.Context, fn func(*Queries) error) error {
+	b, ok := q.db.(interface {
+		Begin(context.Context) (pgx.Tx, error)
+	})
+	if !ok {
+		return ErrNoTx
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction in db.InTx: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // it's a no-op once committed.
+
+	if err := fn(q.WithTx(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction in db.InTx: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package e2e runs jobber and its server against local stand-ins of the job
+// portals, following a feed from its creation to its first offers.
+package e2e
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/jobber"
+	"github.com/alwedo/jobber/server"
+)
+
+var progressPath = regexp.MustCompile(`/f/([0-9a-f-]{36})/progress`)
+
+func TestCreateFeed(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	p := newPortals(t)
+	j, jCloser := jobber.New(t.Context(), l, d, jobber.WithScrapeList(p.scrapers()))
+	defer jCloser()
+	svr, err := server.New(l, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(svr.Handler)
+	defer ts.Close()
+
+	get := func(t *testing.T, path string) string {
+		t.Helper()
+		r, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("unable to perform http request: %v", err)
+		}
+		defer r.Body.Close()
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("unable to read response body: %v", err)
+		}
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("wanted status code %d for %s, got %d: %s", http.StatusOK, path, r.StatusCode, b)
+		}
+		return string(b)
+	}
+
+	r, err := http.PostForm(ts.URL+"/feeds", url.Values{"keywords": {"gopher"}, "location": {"hamburg"}})
+	if err != nil {
+		t.Fatalf("unable to create feed: %v", err)
+	}
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		t.Fatalf("unable to read response body: %v", err)
+	}
+	m := progressPath.FindStringSubmatch(string(b))
+	if r.StatusCode != http.StatusOK || m == nil {
+		t.Fatalf("wanted the feed to be created, got status %d: %s", r.StatusCode, b)
+	}
+
+	t.Run("every portal is searched", func(t *testing.T) {
+		var progress string
+		for range 100 {
+			if progress = get(t, m[0]); !strings.Contains(progress, "hx-trigger") {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		for _, want := range []string{
+			"<b>LinkedIn</b>: done with 27 offers", // Through the 429.
+			"<b>Stepstone</b>: done with 70 offers",
+			"<b>Glassdoor</b>: done with 0 offers",
+		} {
+			if !strings.Contains(progress, want) {
+				t.Errorf("wanted progress to contain %q, got %s", want, progress)
+			}
+		}
+	})
+
+	t.Run("the rss feed has the offers", func(t *testing.T) {
+		var feed struct {
+			Items []struct {
+				Link string `xml:"link"`
+				GUID string `xml:"guid"`
+			} `xml:"channel>item"`
+		}
+		if err := xml.Unmarshal([]byte(get(t, "/f/"+m[1]+".rss")), &feed); err != nil {
+			t.Fatalf("unable to decode rss feed: %v", err)
+		}
+
+		sources := make(map[string]int)
+		for _, i := range feed.Items {
+			source, _, _ := strings.Cut(i.GUID, ":")
+			sources[source]++
+			if !strings.HasPrefix(i.Link, p.linkedIn.URL) && !strings.HasPrefix(i.Link, p.stepstone.URL) {
+				t.Errorf("wanted offer links to point to the portals, got %s", i.Link)
+			}
+		}
+		// Offers found in both portals show up once.
+		if sources["linkedin"] == 0 || sources["stepstone"] == 0 || sources["linkedin"]+sources["stepstone"] > 97 {
+			t.Errorf("wanted up to 97 offers from LinkedIn and Stepstone, got %v", sources)
+		}
+	})
+}
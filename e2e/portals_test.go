@@ -0,0 +1,133 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/scrape"
+	"github.com/alwedo/jobber/scrape/glassdoor"
+	"github.com/alwedo/jobber/scrape/linkedin"
+	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/alwedo/jobber/scrape/scrapetest"
+	"github.com/alwedo/jobber/scrape/stepstone"
+)
+
+// portals are local stand-ins of the job portals serving the responses
+// of the scrapers' cassettes:
+//   - LinkedIn paginates over 3 pages, answering the second one with 429 first.
+//   - Stepstone paginates over 3 pages.
+//   - Glassdoor finds the location but has no offers for it.
+type portals struct {
+	linkedIn, stepstone, glassdoor *httptest.Server
+}
+
+func newPortals(t *testing.T) *portals {
+	t.Helper()
+	p := &portals{
+		linkedIn:  httptest.NewServer(fakeLinkedIn(t)),
+		stepstone: httptest.NewServer(fakeStepstone(t)),
+		glassdoor: httptest.NewServer(fakeGlassdoor(t)),
+	}
+	t.Cleanup(func() {
+		p.linkedIn.Close()
+		p.stepstone.Close()
+		p.glassdoor.Close()
+	})
+	return p
+}
+
+// scrapers returns the real scrapers pointed to the stand-ins.
+// Retries and rate limits are shortened so the test doesn't wait.
+func (p *portals) scrapers() scrape.List {
+	fast := []retryhttp.Option{
+		retryhttp.WithBackoff(10*time.Millisecond, 100*time.Millisecond),
+		retryhttp.WithRateLimit(1000, 100),
+	}
+	return scrape.List{
+		linkedin.Name:  linkedin.New(linkedin.WithBaseURL(p.linkedIn.URL), linkedin.WithClientOptions(fast...)),
+		stepstone.Name: stepstone.New(stepstone.WithBaseURL(p.stepstone.URL), stepstone.WithClientOptions(fast...)),
+		glassdoor.Name: glassdoor.New(glassdoor.WithBaseURL(p.glassdoor.URL), glassdoor.WithClientOptions(fast...)),
+	}
+}
+
+func fakeLinkedIn(t *testing.T) http.Handler {
+	pages := scrapetest.Responses(t, "../scrape/linkedin/test_data/cassette.json", "/jobs-guest/jobs/api/seeMoreJobPostings/search")
+	var mu sync.Mutex
+	throttled := make(map[string]bool) // By keywords, so every query gets its 429.
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs-guest/jobs/api/seeMoreJobPostings/search", func(w http.ResponseWriter, r *http.Request) {
+		page, ok := map[string]int{"": 1, "10": 2, "20": 3}[r.URL.Query().Get("start")]
+		if !ok {
+			return // No more offers.
+		}
+		if page == 2 {
+			mu.Lock()
+			first := !throttled[r.URL.Query().Get("keywords")]
+			throttled[r.URL.Query().Get("keywords")] = true
+			mu.Unlock()
+			if first {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(pages[page-1]))
+	})
+	return mux
+}
+
+func fakeStepstone(t *testing.T) http.Handler {
+	pages := scrapetest.Responses(t, "../scrape/stepstone/test_data/cassette.json", "/public-api/resultlist/unifiedResultlist")
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /public-api/resultlist/unifiedResultlist", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(body.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := strconv.Atoi(u.Query().Get("page"))
+		if err != nil || page < 1 || page > len(pages) {
+			http.Error(w, "unknown page", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page-1]))
+	})
+	return mux
+}
+
+func fakeGlassdoor(t *testing.T) http.Handler {
+	locations := scrapetest.Responses(t, "../scrape/glassdoor/test_data/cassette.json", "/autocomplete/location")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /Job/index.htm", func(w http.ResponseWriter, _ *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "GSESSIONID", Value: "cuak", Path: "/"})
+		_, _ = w.Write([]byte(`<script>window.gdCfg = {"token": "cuak"}</script>`))
+	})
+	mux.HandleFunc("GET /autocomplete/location", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(locations[0]))
+	})
+	mux.HandleFunc("POST /job-search-next/bff/jobSearchResultsQuery", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("gd-csrf-token") != "cuak" {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": {"jobListings": {"jobListings": [], "paginationCursors": []}}}`))
+	})
+	return mux
+}
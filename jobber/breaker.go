@@ -0,0 +1,160 @@
+package jobber
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alwedo/jobber/metrics"
+)
+
+const (
+	// breakerThreshold is how many consecutive failed runs of a scraper open its circuit.
+	breakerThreshold = 5
+	// breakerCoolDown is how long a scraper is skipped once its circuit opens.
+	breakerCoolDown = 15 * time.Minute
+)
+
+// Circuit states of a scraper.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+var ErrCircuitOpen = errors.New("scraper circuit is open")
+
+// Circuit is the state of a scraper's circuit breaker.
+type Circuit struct {
+	Scraper   string
+	State     string
+	Failures  int
+	Skipped   int // Runs skipped since the circuit opened.
+	OpenUntil time.Time
+}
+
+// breaker stops running a scraper after consecutive failures, ie. when its
+// job portal blocks us, so we don't make the block worse by insisting.
+// Once cooled down, a single run probes whether the portal lets us in again.
+// Every instance has its own breakers.
+type breaker struct {
+	name      string
+	threshold int
+	coolDown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	skipped   int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(name string) *breaker {
+	b := &breaker{name: name, threshold: breakerThreshold, coolDown: breakerCoolDown}
+	metrics.JobberCircuitState.WithLabelValues(name).Set(0)
+	return b
+}
+
+// state must be called with the mutex held.
+func (b *breaker) state() string {
+	switch {
+	case b.failures < b.threshold:
+		return CircuitClosed
+	case time.Now().Before(b.openUntil):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// blocked tells whether the scraper can't run right now, either because
+// its circuit is open or because it's already being probed.
+func (b *breaker) blocked() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case CircuitOpen:
+		return true
+	case CircuitHalfOpen:
+		return b.probing
+	default:
+		return false
+	}
+}
+
+// allow tells whether the scraper can run, taking the probe
+// run if the circuit is half-open. Allowed runs call done.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case CircuitOpen:
+		b.skipped++
+		return false
+	case CircuitHalfOpen:
+		if b.probing {
+			b.skipped++
+			return false
+		}
+		b.probing = true
+		metrics.JobberCircuitState.WithLabelValues(b.name).Set(1)
+	}
+	return true
+}
+
+// done records the outcome of a scrape. Interrupted
+// scrapes don't tell anything about the job portal.
+func (b *breaker) done(logger *slog.Logger, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	case err != nil:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = time.Now().Add(b.coolDown)
+			metrics.JobberCircuitState.WithLabelValues(b.name).Set(2)
+			logger.Warn("scraper circuit opened", slog.String("scraper", b.name), slog.Int("failures", b.failures))
+		}
+	default:
+		if b.failures >= b.threshold {
+			logger.Info("scraper circuit closed", slog.String("scraper", b.name))
+		}
+		b.failures = 0
+		b.skipped = 0
+		metrics.JobberCircuitState.WithLabelValues(b.name).Set(0)
+	}
+}
+
+func (b *breaker) circuit() Circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := Circuit{Scraper: b.name, State: b.state(), Failures: b.failures, Skipped: b.skipped}
+	if c.State != CircuitClosed {
+		c.OpenUntil = b.openUntil
+	}
+	return c
+}
+
+// Circuits returns the state of the scrapers' circuit breakers in this instance.
+func (j *Jobber) Circuits() []Circuit {
+	var c []Circuit
+	for _, name := range j.Sources() {
+		c = append(c, j.breakers[name].circuit())
+	}
+	return c
+}
+
+// blockedScrapers returns the scrapers whose jobs can't run right now.
+func (j *Jobber) blockedScrapers() []string {
+	var blocked []string
+	for _, name := range j.Sources() {
+		if j.breakers[name].blocked() {
+			blocked = append(blocked, name)
+		}
+	}
+	return blocked
+}
@@ -0,0 +1,65 @@
+package jobber
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	errBlocked := errors.New("unexpected response code 403")
+	b := &breaker{name: "mock", threshold: 2, coolDown: 50 * time.Millisecond}
+
+	t.Run("it stays closed below the threshold", func(t *testing.T) {
+		b.done(l, errBlocked)
+		b.done(l, context.Canceled) // Interrupted scrapes don't count.
+		if !b.allow() || b.circuit().State != CircuitClosed {
+			t.Errorf("wanted the circuit to be closed, got %+v", b.circuit())
+		}
+	})
+
+	t.Run("it opens after consecutive failures", func(t *testing.T) {
+		b.done(l, errBlocked)
+		if b.allow() || !b.blocked() {
+			t.Errorf("wanted the scraper to be blocked, got %+v", b.circuit())
+		}
+		if c := b.circuit(); c.State != CircuitOpen || c.Failures != 2 || c.Skipped != 1 || c.OpenUntil.IsZero() {
+			t.Errorf("wanted the circuit to be open, got %+v", c)
+		}
+	})
+
+	t.Run("it allows a single probe once cooled down", func(t *testing.T) {
+		time.Sleep(60 * time.Millisecond)
+		if b.blocked() || b.circuit().State != CircuitHalfOpen {
+			t.Errorf("wanted the circuit to be half-open, got %+v", b.circuit())
+		}
+		if !b.allow() {
+			t.Fatal("wanted the probe to be allowed")
+		}
+		if b.allow() || !b.blocked() {
+			t.Error("wanted a single probe at a time")
+		}
+	})
+
+	t.Run("a failed probe opens it again", func(t *testing.T) {
+		b.done(l, errBlocked)
+		if b.allow() || b.circuit().State != CircuitOpen {
+			t.Errorf("wanted the circuit to be open, got %+v", b.circuit())
+		}
+	})
+
+	t.Run("a successful probe closes it", func(t *testing.T) {
+		time.Sleep(60 * time.Millisecond)
+		if !b.allow() {
+			t.Fatal("wanted the probe to be allowed")
+		}
+		b.done(l, nil)
+		if c := b.circuit(); c.State != CircuitClosed || c.Failures != 0 || c.Skipped != 0 || !b.allow() {
+			t.Errorf("wanted the circuit to be closed, got %+v", c)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package jobber
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/alwedo/jobber/db"
+)
+
+// Offer is a canonical offer along with its duplicates
+// published in other job portals.
+type Offer struct {
+	*db.Offer
+	Duplicates []*db.Offer
+}
+
+var (
+	// Job portals disagree on whether to add gender markers
+	// like '(m/w/d)' or 'm/f/x' and extra notes to the titles.
+	parenthesized = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+	genderMarker  = regexp.MustCompile(`\b[mwfdx]\s*/\s*[mwfdx](\s*/\s*[mwfdx])*\b`)
+
+	// legalForms are dropped from company names, ie. 'Späti GmbH' and 'Späti'.
+	legalForms = []string{"gmbh", "mbh", "co", "kg", "ag", "se", "ug", "inc", "ltd", "llc", "plc"}
+)
+
+// fingerprint identifies an offer across job portals by its normalized
+// title, company and city. Offers with the same fingerprint are the same
+// offer if they were posted around the same time in different job portals,
+// a job portal listing it twice means there are two openings.
+func fingerprint(o *db.CreateOfferParams) string {
+	city, _, _ := strings.Cut(o.Location, ",")
+	title := genderMarker.ReplaceAllString(normalize(parenthesized.ReplaceAllString(o.Title, " ")), " ")
+
+	h := sha256.Sum256([]byte(strings.Join([]string{
+		fingerprintTerms(title),
+		fingerprintTerms(o.Company, legalForms...),
+		fingerprintTerms(city),
+	}, "|")))
+	return hex.EncodeToString(h[:])
+}
+
+// fingerprintTerms returns the normalized words of s without punctuation
+// and without the dropped ones.
+func fingerprintTerms(s string, drop ...string) string {
+	terms := strings.FieldsFunc(normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms = slices.DeleteFunc(terms, func(t string) bool { return slices.Contains(drop, t) })
+	return strings.Join(terms, " ")
+}
+
+// groupOffers merges the offers of the same group into their canonical
+// offer keeping the order of the list. The canonical offer is the first
+// one stored so its guid doesn't change when duplicates show up.
+func groupOffers(offers []*db.Offer) []*Offer {
+	grouped := make([]*Offer, 0, len(offers))
+	groups := make(map[int64]*Offer)
+	for _, o := range offers {
+		if !o.GroupID.Valid {
+			grouped = append(grouped, &Offer{Offer: o})
+			continue
+		}
+		g, ok := groups[o.GroupID.Int64]
+		if !ok {
+			g = &Offer{Offer: o}
+			groups[o.GroupID.Int64] = g
+			grouped = append(grouped, g)
+			continue
+		}
+		if o.ID < g.ID {
+			g.Offer, o = o, g.Offer
+		}
+		g.Duplicates = append(g.Duplicates, o)
+	}
+	return grouped
+}
@@ -0,0 +1,106 @@
+package jobber
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := &db.CreateOfferParams{Title: "Backend Developer", Company: "Späti GmbH", Location: "Berlin"}
+
+	tests := []struct {
+		name  string
+		offer *db.CreateOfferParams
+		want  bool
+	}{
+		{
+			name:  "same offer",
+			offer: &db.CreateOfferParams{Title: "Backend Developer", Company: "Späti GmbH", Location: "Berlin"},
+			want:  true,
+		},
+		{
+			name:  "different case and spacing",
+			offer: &db.CreateOfferParams{Title: "  backend   DEVELOPER ", Company: "SPÄTI gmbh", Location: "berlin"},
+			want:  true,
+		},
+		{
+			name:  "gender markers in parenthesis",
+			offer: &db.CreateOfferParams{Title: "Backend Developer (m/w/d)", Company: "Späti GmbH", Location: "Berlin"},
+			want:  true,
+		},
+		{
+			name:  "gender markers without parenthesis",
+			offer: &db.CreateOfferParams{Title: "Backend Developer - m/f/x", Company: "Späti GmbH", Location: "Berlin"},
+			want:  true,
+		},
+		{
+			name:  "company without legal form",
+			offer: &db.CreateOfferParams{Title: "Backend Developer", Company: "Späti", Location: "Berlin"},
+			want:  true,
+		},
+		{
+			name:  "location with region and country",
+			offer: &db.CreateOfferParams{Title: "Backend Developer", Company: "Späti GmbH", Location: "Berlin, Berlin, Deutschland"},
+			want:  true,
+		},
+		{
+			name:  "different title",
+			offer: &db.CreateOfferParams{Title: "Senior Backend Developer", Company: "Späti GmbH", Location: "Berlin"},
+			want:  false,
+		},
+		{
+			name:  "different company",
+			offer: &db.CreateOfferParams{Title: "Backend Developer", Company: "Kiosk GmbH", Location: "Berlin"},
+			want:  false,
+		},
+		{
+			name:  "different city",
+			offer: &db.CreateOfferParams{Title: "Backend Developer", Company: "Späti GmbH", Location: "München"},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fingerprint(tt.offer) == fingerprint(base); got != tt.want {
+				t.Errorf("wanted same fingerprint to be %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGroupOffers(t *testing.T) {
+	group := func(id int64) pgtype.Int8 { return pgtype.Int8{Int64: id, Valid: true} }
+	offers := []*db.Offer{
+		{ID: 4, Source: "Glassdoor", GroupID: group(1)},
+		{ID: 5, Source: "LinkedIn"},
+		{ID: 2, Source: "LinkedIn", GroupID: group(1)},
+		{ID: 3, Source: "Stepstone", GroupID: group(2)},
+		{ID: 1, Source: "Stepstone", GroupID: group(1)},
+	}
+
+	got := groupOffers(offers)
+
+	var gotIDs []int64
+	for _, o := range got {
+		gotIDs = append(gotIDs, o.ID)
+	}
+	// Groups keep the position of their first offer in the list,
+	// and the first offer stored is the canonical one.
+	if want := []int64{1, 5, 3}; !slices.Equal(gotIDs, want) {
+		t.Fatalf("wanted offers %v, got %v", want, gotIDs)
+	}
+	var gotDuplicates []int64
+	for _, d := range got[0].Duplicates {
+		gotDuplicates = append(gotDuplicates, d.ID)
+	}
+	if want := []int64{4, 2}; !slices.Equal(gotDuplicates, want) {
+		t.Errorf("wanted duplicates %v, got %v", want, gotDuplicates)
+	}
+	if len(got[1].Duplicates) != 0 || len(got[2].Duplicates) != 0 {
+		t.Errorf("wanted no duplicates for ungrouped and single offers")
+	}
+}
@@ -0,0 +1,93 @@
+package jobber
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/alwedo/jobber/db"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// filterOffers returns the offers matching the query's filters:
+//   - Offers with any of the exclude keywords in the title, company or description are discarded.
+//   - Offers with any of the title exclude terms in the title are discarded.
+//   - If there are title include terms, the title must contain at least one of them.
+//
+// Terms match whole words, so "go" matches "Go Developer" but not "Google".
+// Filter terms are stored normalized by the server so we only need to
+// normalize the offer fields, which come verbatim from the job portals.
+func filterOffers(offers []*db.Offer, q *db.Query) []*db.Offer {
+	if len(q.ExcludeKeywords) == 0 && len(q.TitleInclude) == 0 && len(q.TitleExclude) == 0 {
+		return offers
+	}
+
+	filtered := make([]*db.Offer, 0, len(offers))
+	for _, o := range offers {
+		title := words(o.Title)
+		text := slices.Concat(title, words(o.Company), words(o.Description))
+		switch {
+		case containsAny(text, q.ExcludeKeywords),
+			containsAny(title, q.TitleExclude),
+			len(q.TitleInclude) > 0 && !containsAny(title, q.TitleInclude):
+			continue
+		}
+		filtered = append(filtered, o)
+	}
+	return filtered
+}
+
+// filterSources returns the offers from the given sources.
+// No sources means all of them.
+func filterSources(offers []*db.Offer, sources []string) []*db.Offer {
+	if len(sources) == 0 {
+		return offers
+	}
+	filtered := make([]*db.Offer, 0, len(offers))
+	for _, o := range offers {
+		if slices.Contains(sources, o.Source) {
+			filtered = append(filtered, o)
+		}
+	}
+	return filtered
+}
+
+// SearchKey returns the key telling the same searches and filter terms
+// apart regardless of how they were typed, ie. "Straße" and "STRASSE".
+// It's only meant for comparisons, case folding changes what's searched.
+func SearchKey(s string) string {
+	return normalize(s)
+}
+
+// normalize composes s into NFC, case folds it and collapses whitespace.
+func normalize(s string) string {
+	s = norm.NFC.String(cases.Fold().String(norm.NFC.String(s)))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// words splits the normalized s into its words. Anything but letters,
+// digits, + and # separates them, so "C++/Go" is "c++" and "go", and
+// "full-stack" and "full stack" are the same words.
+func words(s string) []string {
+	return strings.FieldsFunc(normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '+' && r != '#'
+	})
+}
+
+// containsAny reports whether any of the terms is in the words w,
+// with multi word terms matching consecutive words.
+func containsAny(w []string, terms []string) bool {
+	for _, t := range terms {
+		tw := words(t)
+		if len(tw) == 0 {
+			continue
+		}
+		for i := 0; i+len(tw) <= len(w); i++ {
+			if slices.Equal(w[i:i+len(tw)], tw) {
+				return true
+			}
+		}
+	}
+	return false
+}
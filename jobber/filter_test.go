@@ -0,0 +1,120 @@
+package jobber
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alwedo/jobber/db"
+)
+
+func TestFilterOffers(t *testing.T) {
+	offers := []*db.Offer{
+		{ExternalID: "1", Title: "Senior Golang Developer", Company: "Späti GmbH"},
+		{ExternalID: "2", Title: "Werkstudent Backend (m/w/d)", Company: "Späti GmbH"},
+		{ExternalID: "3", Title: "Senior Sales Manager", Company: "Späti GmbH", Description: "golang is a plus"},
+		{ExternalID: "4", Title: "Golang Engineer", Company: "Top Recruiter Agency"},
+		{ExternalID: "5", Title: "Backend Engineer", Company: "Späti GmbH", Description: "We are looking for a WERKSTUDENTIN"},
+		{ExternalID: "6", Title: "Entwickler für Maßarbeit", Company: "Späti GmbH"},
+		{ExternalID: "7", Title: "Account Manager Google Ads", Company: "MongoDB Inc."},
+		{ExternalID: "8", Title: "C++/Go Full-Stack Engineer", Company: "Späti GmbH"},
+	}
+
+	tests := []struct {
+		name    string
+		query   *db.Query
+		wantIDs []string
+	}{
+		{
+			name:    "no filters",
+			query:   &db.Query{},
+			wantIDs: []string{"1", "2", "3", "4", "5", "6", "7", "8"},
+		},
+		{
+			name:    "exclude keywords match title, company and description",
+			query:   &db.Query{ExcludeKeywords: []string{"werkstudent", "recruiter"}},
+			wantIDs: []string{"1", "3", "5", "6", "7", "8"},
+		},
+		{
+			name:    "title exclude only matches the title",
+			query:   &db.Query{TitleExclude: []string{"werkstudent", "sales"}},
+			wantIDs: []string{"1", "4", "5", "6", "7", "8"},
+		},
+		{
+			name:    "title include needs any of the terms in the title",
+			query:   &db.Query{TitleInclude: []string{"golang", "backend"}},
+			wantIDs: []string{"1", "2", "4", "5"},
+		},
+		{
+			name:    "terms match whole words",
+			query:   &db.Query{TitleInclude: []string{"go"}, ExcludeKeywords: []string{"mongo"}},
+			wantIDs: []string{"8"},
+		},
+		{
+			name:    "terms keep their symbols",
+			query:   &db.Query{TitleInclude: []string{"c++"}},
+			wantIDs: []string{"8"},
+		},
+		{
+			name:    "multi word terms match consecutive words",
+			query:   &db.Query{TitleInclude: []string{"full stack", "senior developer"}},
+			wantIDs: []string{"8"},
+		},
+		{
+			name:    "offer fields are case folded",
+			query:   &db.Query{TitleInclude: []string{"massarbeit"}},
+			wantIDs: []string{"6"},
+		},
+		{
+			name: "filters are combined",
+			query: &db.Query{
+				ExcludeKeywords: []string{"werkstudent"},
+				TitleInclude:    []string{"golang", "backend"},
+				TitleExclude:    []string{"senior"},
+			},
+			wantIDs: []string{"4", "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIDs []string
+			for _, o := range filterOffers(offers, tt.query) {
+				gotIDs = append(gotIDs, o.ExternalID)
+			}
+			if !slices.Equal(gotIDs, tt.wantIDs) {
+				t.Errorf("wanted offers %v, got %v", tt.wantIDs, gotIDs)
+			}
+		})
+	}
+}
+
+func TestFilterSources(t *testing.T) {
+	offers := []*db.Offer{
+		{ExternalID: "1", Source: "LinkedIn"},
+		{ExternalID: "2", Source: "Stepstone"},
+		{ExternalID: "3", Source: "Glassdoor"},
+	}
+
+	tests := []struct {
+		name    string
+		sources []string
+		wantIDs []string
+	}{
+		{name: "no sources", wantIDs: []string{"1", "2", "3"}},
+		{name: "one source", sources: []string{"Stepstone"}, wantIDs: []string{"2"}},
+		{name: "many sources", sources: []string{"LinkedIn", "Stepstone"}, wantIDs: []string{"1", "2"}},
+		{name: "unknown source", sources: []string{"cuak"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIDs []string
+			for _, o := range filterSources(offers, tt.sources) {
+				gotIDs = append(gotIDs, o.ExternalID)
+			}
+			if !slices.Equal(gotIDs, tt.wantIDs) {
+				t.Errorf("wanted offers %v, got %v", tt.wantIDs, gotIDs)
+			}
+		})
+	}
+}
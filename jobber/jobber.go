@@ -1,48 +1,49 @@
 // Package jobber orchestrates scheduled scraping of job offers from external sources based on
 // user-defined search queries. It manages query lifecycle (creation, scheduling, expiration),
 // persists results to a database, and automatically prunes stale queries after 7 days of inactivity.
-// Each query runs on an hourly cron schedule, deduplicates offers, and maintains query-offer
-// associations for efficient retrieval.
+// Each query's scraper is a job in a durable work queue, run hourly by default by a pool of
+// workers, deduplicates offers, and maintains query-offer associations for efficient retrieval.
 package jobber
 
 import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
-	"strconv"
-	"sync/atomic"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/metrics"
 	"github.com/alwedo/jobber/scrape"
+	"github.com/alwedo/jobber/scrape/retryhttp"
 	"github.com/go-co-op/gocron/v2"
-	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Jobber struct {
-	ctx     context.Context
-	scrList scrape.List
-	logger  *slog.Logger
-	db      *db.Queries
-	sched   gocron.Scheduler
-	timeOut time.Duration
+	ctx      context.Context
+	scrList  scrape.List
+	logger   *slog.Logger
+	db       *db.Queries
+	sched    gocron.Scheduler
+	locker   gocron.Locker
+	policy   Policy
+	workers  int
+	wake     chan struct{}
+	breakers map[string]*breaker
 }
 
-var ErrTimedOut = errors.New("operation timed out")
+var ErrUnknownSource = errors.New("unknown source")
 
 type Options func(*Jobber)
 
-func WithTimeOut(t time.Duration) Options {
-	return func(j *Jobber) {
-		j.timeOut = t
-	}
-}
-
+// WithScrapeList sets the scrapers run by the jobber, all the available
+// ones by default.
 func WithScrapeList(sl scrape.List) Options {
 	return func(j *Jobber) {
 		j.scrList = sl
@@ -50,212 +51,426 @@ func WithScrapeList(sl scrape.List) Options {
 }
 
 func New(ctx context.Context, log *slog.Logger, db *db.Queries, opts ...Options) (*Jobber, func()) {
-	sched, err := gocron.NewScheduler()
-	if err != nil {
-		log.Error("failed to create scheduler", slog.String("error", err.Error()))
-	}
 	ctx, cancelCtx := context.WithCancel(ctx) //nolint:gosec
 	j := &Jobber{
 		ctx:     ctx,
-		scrList: scrape.New(),
 		logger:  log,
 		db:      db,
-		sched:   sched,
-		timeOut: 10 * time.Second,
+		policy:  Every(time.Hour),
+		workers: defaultWorkers,
+		wake:    make(chan struct{}, 1),
 	}
 
 	for _, o := range opts {
 		o(j)
 	}
+	// Scrapers are only built if no list was given, since
+	// building them loads their clients' user agents.
+	if j.scrList == nil {
+		j.scrList = scrape.New()
+	}
+
+	j.breakers = make(map[string]*breaker, len(j.scrList))
+	for name := range j.scrList {
+		j.breakers[name] = newBreaker(name)
+	}
+
+	var schedOpts []gocron.SchedulerOption
+	if j.locker != nil {
+		schedOpts = append(schedOpts, gocron.WithDistributedLocker(j.locker))
+	}
+	sched, err := gocron.NewScheduler(schedOpts...)
+	if err != nil {
+		log.Error("failed to create scheduler", slog.String("error", err.Error()))
+	}
+	j.sched = sched
 
-	// Initial job scheduling.
+	// Queries created before the work queue, or whose sources got new
+	// scrapers, are enqueued at the minute they were created at, like
+	// the cron jobs they replace.
 	queries, err := j.db.ListQueries(ctx)
 	if err != nil {
-		j.logger.Error("unable to list queries in jobber.scheduleQueries", slog.String("error", err.Error()))
+		j.logger.Error("unable to list queries in jobber.New", slog.String("error", err.Error()))
 	}
 	for _, q := range queries {
-		j.scheduleQuery(q)
+		if err := j.enqueueQuery(ctx, q, 0, nextMinute(q.CreatedAt.Time)); err != nil {
+			j.logger.Error("unable to enqueue query in jobber.New", slog.Int64("queryID", q.ID), slog.String("error", err.Error()))
+		}
 	}
+	wait := j.startWorkers()
 	j.schedDeleteOldOffers()
+	j.schedCheckOffers()
 	j.sched.Start()
 
 	return j, func() {
 		cancelCtx()
+		wait()
 		if err := j.sched.Shutdown(); err != nil {
 			j.logger.Error("failed to shutdown scheduler", slog.String("error", err.Error()))
 		}
 	}
 }
 
-// CreateQuery creates a new query, schedules it for future runs
-// and also runs it immediately. While running it immediately it
-// will block the caller until the job finishes or it times out.
-func (j *Jobber) CreateQuery(ctx context.Context, keywords, location string) error {
-	query, err := j.db.CreateQuery(ctx, &db.CreateQueryParams{
-		Keywords: keywords,
-		Location: location,
-	})
+// CreateQuery creates a new query and enqueues it to run right away,
+// ahead of the scheduled queries, and periodically afterwards. The
+// progress of its first run can be followed with Progress.
+// If the query already exists it returns the existing one.
+// The same keywords and location with different filters or
+// sources are different queries. No sources means all of them.
+func (j *Jobber) CreateQuery(ctx context.Context, cqp *db.CreateQueryParams) (*db.Query, error) {
+	for _, src := range cqp.Sources {
+		if _, ok := j.scrList[src]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSource, src)
+		}
+	}
+	// The same search typed differently is the same query.
+	p := *cqp
+	p.KeywordsKey = pgtype.Text{String: SearchKey(cqp.Keywords), Valid: true}
+	p.LocationKey = pgtype.Text{String: SearchKey(cqp.Location), Valid: true}
+	query, err := j.db.CreateQuery(ctx, &p)
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-		// If the query exist we just return. The server will respond with the RSS feed url.
-		return nil
+		// If the query exist we just return it. The server will respond with the feed url.
+		q, err := j.db.GetQuery(ctx, &db.GetQueryParams{
+			KeywordsKey:     p.KeywordsKey.String,
+			LocationKey:     p.LocationKey.String,
+			ExcludeKeywords: cqp.ExcludeKeywords,
+			TitleInclude:    cqp.TitleInclude,
+			TitleExclude:    cqp.TitleExclude,
+			Sources:         cqp.Sources,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get existing query: %w", err)
+		}
+		return q, nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to create query: %w", err)
+		return nil, fmt.Errorf("failed to create query: %w", err)
 	}
 	j.logger.Info("created new query",
 		slog.Int64("queryID", query.ID),
-		slog.String("keywords", keywords),
-		slog.String("location", location),
+		slog.String("keywords", query.Keywords),
+		slog.String("location", query.Location),
 	)
-	metrics.JobberNewQueries.WithLabelValues(keywords, location).Inc()
-
-	done := make(chan struct{})
-	var tasks atomic.Int64
-	tasks.Store(int64(len(j.scrList)))
+	metrics.JobberNewQueries.WithLabelValues(query.Keywords, query.Location).Inc()
 
-	o := []gocron.JobOption{
-		gocron.WithStartAt(gocron.WithStartImmediately()),
-		gocron.WithEventListeners(gocron.AfterJobRuns(func(uuid.UUID, string) {
-			if tasks.Add(-1) == 0 {
-				close(done)
-			}
-		})),
+	if err := j.enqueueQuery(ctx, query, priorityNew, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to enqueue query: %w", err)
 	}
+	j.notify()
 
-	j.scheduleQuery(query, o...)
+	return query, nil
+}
 
-	// Blocks and waits for the job to finish or for a timeout.
-	select {
-	case <-ctx.Done():
-		return context.Canceled
-	case <-done:
-		return nil
-	case <-time.After(j.timeOut):
-		j.logger.Info("scheduleQuery in jobber.CreateQuery took more than 10 sec", slog.String("keywords", keywords), slog.String("location", location))
-		return ErrTimedOut
+// GetQuery returns the query for the given keywords, location and filters.
+// It's used to resolve legacy feed urls into the query's public id.
+// Returns sql.ErrNoRows for non-existent query.
+func (j *Jobber) GetQuery(ctx context.Context, gqp *db.GetQueryParams) (*db.Query, error) {
+	q, err := j.db.GetQuery(ctx, gqp)
+	if err != nil {
+		return nil, fmt.Errorf("getting query in jobber.GetQuery: %w", err)
 	}
+	return q, nil
 }
 
-// ListOffers return the list of offers for a given query's keywords
-// and location and the last time the query was updated to calculate
-// the Cache-Control header. Returns sql.ErrNoRows for non-existent query.
-func (j *Jobber) ListOffers(ctx context.Context, gqp *db.GetQueryParams) ([]*db.Offer, *pgtype.Timestamptz, error) {
-	q, err := j.db.GetQuery(ctx, gqp)
+// ListOffers return the list of offers for a given query's public id
+// matching the query's filters and the query itself, whose last update
+// time is used to calculate the Cache-Control header.
+// Offers can be further narrowed down to the given sources, and the ones
+// published in several sources are merged into their canonical offer.
+// Feeds call FeedVersion first, which marks the query as used.
+// Returns sql.ErrNoRows for non-existent query.
+func (j *Jobber) ListOffers(ctx context.Context, publicID pgtype.UUID, sources []string) ([]*Offer, *db.Query, error) {
+	q, err := j.db.GetQueryByPublicID(ctx, publicID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("getting query in jobber.ListOffers: %w", err)
 	}
-	if err := j.db.UpdateQueryQAT(ctx, q.ID); err != nil {
-		j.logger.Error("unable to update query timestamp in jobber.ListOffers", slog.Int64("queryID", q.ID), slog.String("error", err.Error()))
-	}
 	o, err := j.db.ListOffers(ctx, q.ID)
 	if err != nil {
-		return o, nil, fmt.Errorf("listing offers in jobber.ListOffers: %w", err)
+		return nil, nil, fmt.Errorf("listing offers in jobber.ListOffers: %w", err)
 	}
-	return o, &q.UpdatedAt, nil
+	return groupOffers(filterSources(filterOffers(o, q), sources)), q, nil
 }
 
-func (j *Jobber) runQuery(ctx context.Context, qID int64, scraperName string) {
+// exportPageSize is how many offers ExportOffers reads at once.
+const exportPageSize = 500
+
+// ExportOffers pages through every offer of the given query as stored,
+// closed ones included and neither filtered nor grouped, so exports don't
+// have to hold all of them at once. Offers can be narrowed down to the
+// given sources.
+func (j *Jobber) ExportOffers(ctx context.Context, queryID int64, sources []string) iter.Seq2[[]*db.Offer, error] {
+	return func(yield func([]*db.Offer, error) bool) {
+		var after int64
+		for {
+			page, err := j.db.ListOffersPage(ctx, &db.ListOffersPageParams{
+				QueryID:  queryID,
+				After:    after,
+				Sources:  sources,
+				PageSize: exportPageSize,
+			})
+			if err != nil {
+				yield(nil, fmt.Errorf("listing offers page in jobber.ExportOffers: %w", err))
+				return
+			}
+			if len(page) == 0 || !yield(page, nil) || len(page) < exportPageSize {
+				return
+			}
+			after = page[len(page)-1].ID
+		}
+	}
+}
+
+// queriedAtPeriod is how often a query is marked as used at most. Unused
+// queries are only removed after days, so it doesn't need to be precise.
+const queriedAtPeriod = time.Hour
+
+// FeedVersion returns the query's update times so callers can tell if a
+// feed changed without listing its offers. FeedUpdatedAt changes on every
+// scrape and whenever offers are closed or deleted, while UpdatedAt only
+// changes on scrapes. Every feed request calls it, conditional or not, so
+// it's where the query is marked as used, at most once per queriedAtPeriod
+// since feed readers poll far more often than that.
+// Returns sql.ErrNoRows for non-existent query.
+func (j *Jobber) FeedVersion(ctx context.Context, publicID pgtype.UUID) (*db.GetQueryVersionRow, error) {
+	v, err := j.db.GetQueryVersion(ctx, publicID)
+	if err != nil {
+		return nil, fmt.Errorf("getting query version in jobber.FeedVersion: %w", err)
+	}
+	if time.Since(v.QueriedAt.Time) > queriedAtPeriod {
+		if err := j.db.UpdateQueryQAT(ctx, v.ID); err != nil {
+			j.logger.Error("unable to update query timestamp in jobber.FeedVersion", slog.Int64("queryID", v.ID), slog.String("error", err.Error()))
+		}
+	}
+	return v, nil
+}
+
+// runQuery scrapes the query with the given scraper and saves its offers,
+// recording the state of the run as it goes and its outcome once done.
+// The returned error tells the work queue to retry the run.
+func (j *Jobber) runQuery(ctx context.Context, qID int64, scraperName string) (err error) {
 	logAttr := []any{slog.Int64("queryID", qID), slog.String("scraper", scraperName)}
 
 	s, ok := j.scrList[scraperName]
 	if !ok {
 		j.logger.Error("unable to find scraper in jobber.runQuery", logAttr...)
-		return
+		return fmt.Errorf("%w: %s", ErrUnknownSource, scraperName)
 	}
 
 	q, err := j.db.GetQueryScraper(ctx, &db.GetQueryScraperParams{ID: qID, ScraperName: scraperName})
 	if err != nil {
 		j.logger.Error("unable to get query in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
-		return
+		return fmt.Errorf("failed to get query: %w", err)
 	}
 	logAttr = append(logAttr, slog.String("keywords", q.Keywords), slog.String("location", q.Location))
 
 	// We remove queries that haven't been used for longer than 7 days.
 	if time.Since(q.QueriedAt.Time) > time.Hour*24*7 {
+		// Its jobs are deleted along with it.
 		if err := j.db.DeleteQuery(ctx, q.ID); err != nil {
 			j.logger.Error("unable to delete query in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+			return fmt.Errorf("failed to delete query: %w", err)
 		}
-		j.sched.RemoveByTags(q.Keywords + q.Location)
-		metrics.JobberScheduledQueries.WithLabelValues(fmt.Sprintf("%d", q.ID), q.Keywords+q.Location, "").Sub(float64(len(j.scrList)))
+		metrics.JobberScheduledQueries.DeleteLabelValues(fmt.Sprintf("%d", q.ID), q.Keywords+q.Location, "")
 
 		j.logger.Info("deleting unused query", logAttr...)
-		return
+		return nil
 	}
 
-	offers, err := s.Scrape(ctx, q)
-	if err != nil {
-		j.logger.Error("scrape in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+	run := &db.CreateScrapeRunParams{
+		QueryID:     q.ID,
+		ScraperName: scraperName,
+		StartedAt:   pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	ctx, stats := retryhttp.WithStats(ctx)
+	defer func() { j.recordRun(ctx, run, stats, err) }()
+
+	// Runs skipped by an open circuit are recorded as well, so the
+	// query's runs tell why its feed isn't getting new offers.
+	b := j.breakers[scraperName]
+	if !b.allow() {
+		j.setState(ctx, q.ID, scraperName, StateFailed, 0, unavailableReason(scraperName))
+		return fmt.Errorf("skipped: %w", ErrCircuitOpen)
+	}
+	// Only the scrape's outcome counts, the offers failing to be saved
+	// doesn't mean the job portal is blocking us.
+	var scrapeErr error
+	defer func() { b.done(j.logger, scrapeErr) }()
+
+	j.setState(ctx, q.ID, scraperName, StateRunning, 0, "")
+
+	// Every page is saved as soon as it's scraped so a failure midway
+	// doesn't lose the pages before it, ie. after too many requests.
+	var saved int
+	for offers, err := range s.Scrape(ctx, q) {
+		if err != nil {
+			scrapeErr = err
+			j.logger.Error("scrape in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+			break
+		}
+		run.Pages++
+		if len(offers) == 0 {
+			continue
+		}
+		run.Offers += int32(len(offers)) //nolint: gosec // pages are way below int32 offers.
+		newOffers, err := j.saveOffers(ctx, q.ID, scraperName, offers)
+		if err != nil {
+			j.logger.Error("unable to save offers in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+			j.setState(ctx, q.ID, scraperName, StateFailed, saved, "we were unable to save the offers")
+			return err
+		}
+		run.NewOffers += int32(newOffers) //nolint: gosec // pages are way below int32 offers.
+		saved += len(offers)
+		j.setState(ctx, q.ID, scraperName, StateRunning, saved, "")
+	}
+	if scrapeErr != nil {
+		j.setState(ctx, q.ID, scraperName, StateFailed, saved, failureReason(scrapeErr))
 		// We only return after an error if there are no offers since
 		// some cases (ie, too many requests) will have partial results.
-		if len(offers) == 0 {
-			return
+		if saved == 0 {
+			return scrapeErr
 		}
+	} else {
+		j.setState(ctx, q.ID, scraperName, StateDone, saved, "")
 	}
 
-	if len(offers) > 0 {
-		for _, o := range offers {
-			if err := j.db.CreateOffer(ctx, &o); err != nil {
-				j.logger.Error("unable to create offer in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
-				continue
-			}
-			if err := j.db.CreateQueryOfferAssoc(ctx, &db.CreateQueryOfferAssocParams{
-				QueryID: q.ID,
-				OfferID: o.ID,
-			}); err != nil {
-				j.logger.Error("unable to create query offer association in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+	// The scraper timestamp narrows the time range of the next searches, so
+	// it's only updated once the scrape finished and not with every page,
+	// otherwise an interrupted scrape would skip its missing pages for good.
+	if err := j.db.InTx(ctx, func(tx *db.Queries) error {
+		if saved > 0 {
+			if err := tx.UpdateQueryScrapedAt(ctx, &db.UpdateQueryScrapedAtParams{QueryID: q.ID, ScraperName: scraperName}); err != nil {
+				return fmt.Errorf("failed to update scraper timestamp: %w", err)
 			}
 		}
-		if err := j.db.UpdateQueryScrapedAt(ctx, &db.UpdateQueryScrapedAtParams{QueryID: q.ID, ScraperName: scraperName}); err != nil {
-			j.logger.Error("unable to update scraper timestamp in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+		if err := tx.UpdateQueryUAT(ctx, q.ID); err != nil {
+			return fmt.Errorf("failed to update query timestamp: %w", err)
 		}
-	}
-
-	if err := j.db.UpdateQueryUAT(ctx, q.ID); err != nil {
-		j.logger.Error("unable to update query timestamp in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
+		return nil
+	}); err != nil {
+		j.logger.Error("unable to update query timestamps in jobber.runQuery", append(logAttr, slog.String("error", err.Error()))...)
 	}
 
 	j.logger.Debug("successfuly completed jobber.runQuery", logAttr...)
+	return scrapeErr
 }
 
-// Schedules the query for every scraper.
-func (j *Jobber) scheduleQuery(q *db.Query, o ...gocron.JobOption) {
-	// We stagger the query cron trigger by a minute per scraper to avoid
-	// further jobs being fired after a query has been deleted.
-	// By staggering we allow the first job to delete the query and the
-	// subsequent scraper jobs. When not staggered that will lead to some
-	// jobs firing after the query has already been deleted.
-	var stagger int
-
-	for name := range j.scrList {
-		opts := []gocron.JobOption{gocron.WithTags(q.Keywords+q.Location, name)}
-		opts = append(opts, o...)
+// saveOffers persists a page of scraped offers of a query along with their
+// revisions, groups and query associations, returning how many of them are new.
+// It's done in a single transaction with batched statements, so it costs a
+// handful of round trips regardless of the number of offers and a failure
+// doesn't leave a half-written page behind.
+func (j *Jobber) saveOffers(ctx context.Context, qID int64, scraperName string, offers []db.CreateOfferParams) (newOffers int, err error) {
+	start := time.Now()
+	defer func() {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+		metrics.JobberSaveOffers.WithLabelValues(scraperName, status).Observe(time.Since(start).Seconds())
+	}()
+
+	err = j.db.InTx(ctx, func(tx *db.Queries) error {
+		newOffers = 0
+		// Once a statement fails the transaction is aborted and the
+		// following ones fail too, so we only keep the first error.
+		var batchErr error
+		keepErr := func(_ int, err error) {
+			if batchErr == nil {
+				batchErr = err
+			}
+		}
 
-		minute := q.CreatedAt.Time.Minute() + stagger
-		if minute > 59 {
-			minute = stagger
+		params := make([]*db.CreateOfferParams, len(offers))
+		for i := range offers {
+			params[i] = &offers[i]
+		}
+		var (
+			revisions []*db.CreateOfferRevisionParams
+			groups    []*db.AssignOfferGroupParams
+			assocs    = make([]*db.CreateQueryOfferAssocParams, 0, len(offers))
+		)
+		tx.CreateOffer(ctx, params).QueryRow(func(i int, offer *db.CreateOfferRow, err error) {
+			if err != nil {
+				keepErr(i, err)
+				return
+			}
+			o := params[i]
+			if !offer.PreviousTitle.Valid {
+				newOffers++
+			}
+			if fields := offerChanges(offer, o); len(fields) > 0 {
+				revisions = append(revisions, &db.CreateOfferRevisionParams{
+					OfferID:     offer.ID,
+					Fields:      fields,
+					Title:       offer.PreviousTitle.String,
+					Company:     offer.PreviousCompany.String,
+					Location:    offer.PreviousLocation.String,
+					PostedAt:    offer.PreviousPostedAt,
+					Description: offer.PreviousDescription.String,
+					Url:         offer.PreviousUrl.String,
+				})
+			}
+			if !offer.GroupID.Valid {
+				groups = append(groups, &db.AssignOfferGroupParams{
+					Fingerprint: fingerprint(o),
+					PostedAt:    o.PostedAt,
+					ID:          offer.ID,
+				})
+			}
+			assocs = append(assocs, &db.CreateQueryOfferAssocParams{QueryID: qID, OfferID: offer.ID})
+		})
+		if batchErr != nil {
+			return fmt.Errorf("failed to create offers in jobber.saveOffers: %w", batchErr)
+		}
+		tx.CreateOfferRevision(ctx, revisions).Exec(keepErr)
+		if batchErr != nil {
+			return fmt.Errorf("failed to create offer revisions in jobber.saveOffers: %w", batchErr)
 		}
+		tx.AssignOfferGroup(ctx, groups).Exec(keepErr)
+		if batchErr != nil {
+			return fmt.Errorf("failed to assign offer groups in jobber.saveOffers: %w", batchErr)
+		}
+		tx.CreateQueryOfferAssoc(ctx, assocs).Exec(keepErr)
+		if batchErr != nil {
+			return fmt.Errorf("failed to create query offer associations in jobber.saveOffers: %w", batchErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return newOffers, nil
+}
 
-		cron := strconv.Itoa(minute) + " * * * *"
-		stagger++
+// Sources returns the names of the available scrapers.
+func (j *Jobber) Sources() []string {
+	return slices.Sorted(maps.Keys(j.scrList))
+}
 
-		job, err := j.sched.NewJob(
-			gocron.CronJob(cron, false),
-			gocron.NewTask(func(q int64) { j.runQuery(j.ctx, q, name) }, q.ID),
-			opts...,
-		)
-		if err != nil {
-			j.logger.Error("unable to schedule query in jobber.scheduleQuery",
-				slog.Int64("queryID", q.ID),
-				slog.String("scraper", name),
-				slog.String("error", err.Error()),
-			)
-			continue
+// querySources returns the scrapers a query runs against.
+// Queries without sources run against all of them.
+func (j *Jobber) querySources(sources []string) []string {
+	if len(sources) == 0 {
+		return j.Sources()
+	}
+	var s []string
+	for _, name := range sources {
+		if _, ok := j.scrList[name]; ok {
+			s = append(s, name)
 		}
+	}
+	return s
+}
 
-		metrics.JobberScheduledQueries.WithLabelValues(fmt.Sprintf("%d", q.ID), q.Keywords+q.Location+name, cron).Inc()
-		j.logger.Info("scheduled query", slog.Int64("queryID", q.ID), slog.String("cron", cron), slog.Any("tags", job.Tags()))
+// nextMinute returns the next time at the minute of the hour of t.
+func nextMinute(t time.Time) time.Time {
+	now := time.Now()
+	next := now.Truncate(time.Hour).Add(time.Duration(t.Minute()) * time.Minute)
+	if !next.After(now) {
+		next = next.Add(time.Hour)
 	}
+	return next
 }
 
 func (j *Jobber) schedDeleteOldOffers() {
@@ -265,7 +480,17 @@ func (j *Jobber) schedDeleteOldOffers() {
 			if err := j.db.DeleteOldOffers(j.ctx); err != nil {
 				j.logger.Error("unable to delete old offers", slog.String("error", err.Error()))
 			}
+			if err := j.db.DeleteOrphanOfferGroups(j.ctx); err != nil {
+				j.logger.Error("unable to delete orphan offer groups", slog.String("error", err.Error()))
+			}
+			if err := j.db.DeleteOldScrapeRuns(j.ctx); err != nil {
+				j.logger.Error("unable to delete old scrape runs", slog.String("error", err.Error()))
+			}
+			if err := j.db.DeleteExpiredJobLocks(j.ctx); err != nil {
+				j.logger.Error("unable to delete expired job locks", slog.String("error", err.Error()))
+			}
 		}),
+		gocron.WithName("delete-old-offers"),
 		gocron.WithStartAt(gocron.WithStartImmediately()),
 	)
 	if err != nil {
@@ -6,12 +6,16 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"maps"
+	"reflect"
 	"slices"
 	"testing"
 	"time"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/scrape"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func TestConstructor(t *testing.T) {
@@ -24,8 +28,8 @@ func TestConstructor(t *testing.T) {
 	// Give the scheduler time to process initial jobs.
 	time.Sleep(100 * time.Millisecond)
 
-	t.Run("constructor schedules existing queries", func(t *testing.T) {
-		wantJobs := 5 // Four queries from DB seed + old offers deletetion.
+	t.Run("constructor schedules the maintenance jobs", func(t *testing.T) {
+		wantJobs := 2 // Old offers deletetion + offers check.
 		gotJobs := len(j.sched.Jobs())
 
 		if wantJobs != gotJobs {
@@ -33,6 +37,27 @@ func TestConstructor(t *testing.T) {
 		}
 	})
 
+	t.Run("constructor keeps the given scrapers", func(t *testing.T) {
+		if !maps.Equal(j.scrList, scrape.MockList) {
+			t.Errorf("wanted the given scrapers, got %v", j.scrList)
+		}
+	})
+
+	t.Run("constructor enqueues existing queries", func(t *testing.T) {
+		for id := range int64(4) { // Four queries from DB seed.
+			jobs, err := d.ListScrapeJobs(t.Context(), id+1)
+			if err != nil {
+				t.Fatalf("wanted no error, got: %v", err)
+			}
+			if len(jobs) != 1 {
+				t.Fatalf("wanted query %d to have 1 job, got %d", id+1, len(jobs))
+			}
+			if next := jobs[0].NextRunAt.Time; time.Until(next) <= 0 || time.Until(next) > time.Hour {
+				t.Errorf("wanted query %d to run within the next hour, got %v", id+1, next)
+			}
+		}
+	})
+
 	t.Run("old offers should've been deleted", func(t *testing.T) {
 		offers, err := d.ListOffers(t.Context(), 1)
 		if err != nil {
@@ -57,39 +82,51 @@ func TestCreateQuery(t *testing.T) {
 	t.Run("creates a query", func(t *testing.T) {
 		k := "cuak"
 		l := "squeek"
-		if err := j.CreateQuery(t.Context(), k, l); err != nil {
+		created, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: k, Location: l})
+		if err != nil {
 			t.Fatalf("failed to create query: %s", err)
 		}
-		q, err := d.GetQuery(context.Background(), &db.GetQueryParams{Keywords: k, Location: l})
+		q, err := d.GetQuery(context.Background(), &db.GetQueryParams{KeywordsKey: k, LocationKey: l})
 		if err != nil {
 			t.Errorf("failed to get query: %s", err)
 		}
+		if !created.PublicID.Valid || created.PublicID != q.PublicID {
+			t.Errorf("expected created query to have public id %v, got %v", q.PublicID, created.PublicID)
+		}
 		if q.Keywords != k {
 			t.Errorf("expected keywords to be '%s', got %s", k, q.Keywords)
 		}
 		if q.Location != l {
 			t.Errorf("expected location to be '%s', got %s", l, q.Location)
 		}
-		gotJobs := len(j.sched.Jobs())
-		wantJobs := 11 // Four queries from DB seed x 2 + recently created x 2 + old offers deletetion.
-		if wantJobs != gotJobs {
-			t.Errorf("wanted %d jobs, got %d", wantJobs, gotJobs)
-		}
-		time.Sleep(50 * time.Millisecond)
-		for _, jb := range j.sched.Jobs() {
-			if slices.Contains(jb.Tags(), k+l) {
-				lr, _ := jb.LastRunStartedAt() //nolint: errcheck
-				if lr.Before(time.Now().Add(-time.Second)) {
-					t.Errorf("expected created query to have been performed immediately, got %v", lr)
-				}
+		time.Sleep(100 * time.Millisecond)
+		jobs, err := d.ListScrapeJobs(t.Context(), created.ID)
+		if err != nil {
+			t.Fatalf("failed to list jobs: %s", err)
+		}
+		if len(jobs) != 2 {
+			t.Fatalf("wanted 2 jobs, got %d", len(jobs))
+		}
+		for _, jb := range jobs {
+			// Once run, the jobs are due again in an hour.
+			if time.Until(jb.NextRunAt.Time) < 59*time.Minute || jb.Priority != 0 || jb.LockedUntil.Valid {
+				t.Errorf("expected created query to have been performed immediately, got %+v", jb)
 			}
 		}
 	})
 
 	t.Run("on existing query it returns the existing one", func(t *testing.T) {
-		if err := j.CreateQuery(t.Context(), "golang", "berlin"); err != nil {
+		existing, err := d.GetQuery(context.Background(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
+		if err != nil {
+			t.Fatalf("failed to get query: %s", err)
+		}
+		got, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "golang", Location: "berlin"})
+		if err != nil {
 			t.Fatalf("failed to create existing query: %s", err)
 		}
+		if got.ID != existing.ID || got.PublicID != existing.PublicID {
+			t.Errorf("expected existing query %d, got %d", existing.ID, got.ID)
+		}
 		q, err := d.ListQueries(context.Background())
 		if err != nil {
 			t.Fatalf("failed to list queries: %s", err)
@@ -97,15 +134,93 @@ func TestCreateQuery(t *testing.T) {
 		if len(q) != 5 { // 4 from the seed + last test.
 			t.Errorf("expected number of queries to be 5, got %d", len(q))
 		}
-		wantJobs := 11 // 4 from the seed x2  + last test x2 + old offers deletetion.
-		gotJobs := len(j.sched.Jobs())
-		if wantJobs != gotJobs {
-			t.Errorf("want %d jobs, got %d", wantJobs, gotJobs)
+		jobs, err := d.ListScrapeJobs(t.Context(), existing.ID)
+		if err != nil {
+			t.Fatalf("failed to list jobs: %s", err)
+		}
+		if len(jobs) != 2 || jobs[0].Priority != 0 {
+			t.Errorf("expected the existing query's jobs to be left untouched, got %+v", jobs)
+		}
+	})
+
+	t.Run("same search typed differently is the existing query", func(t *testing.T) {
+		created, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "straße", Location: "münchen"})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		got, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "STRASSE", Location: "MÜNCHEN"})
+		if err != nil {
+			t.Fatalf("failed to create existing query: %s", err)
+		}
+		if got.ID != created.ID {
+			t.Errorf("expected existing query %d, got %d", created.ID, got.ID)
+		}
+		// The search is kept as typed first, since folding it changes what's searched.
+		if got.Keywords != "straße" || got.KeywordsKey != "strasse" {
+			t.Errorf("expected keywords 'straße' with key 'strasse', got %q with %q", got.Keywords, got.KeywordsKey)
+		}
+	})
+
+	t.Run("same search with different filters is a new query", func(t *testing.T) {
+		cqp := &db.CreateQueryParams{
+			Keywords:        "golang",
+			Location:        "berlin",
+			ExcludeKeywords: []string{"werkstudent"},
+			TitleExclude:    []string{"sales"},
+		}
+		created, err := j.CreateQuery(t.Context(), cqp)
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		if !slices.Equal(created.ExcludeKeywords, cqp.ExcludeKeywords) || !slices.Equal(created.TitleExclude, cqp.TitleExclude) {
+			t.Errorf("expected filters to be persisted, got %v and %v", created.ExcludeKeywords, created.TitleExclude)
+		}
+		if len(created.TitleInclude) != 0 {
+			t.Errorf("expected no title include terms, got %v", created.TitleInclude)
+		}
+		again, err := j.CreateQuery(t.Context(), cqp)
+		if err != nil {
+			t.Fatalf("failed to create existing query: %s", err)
+		}
+		if again.ID != created.ID {
+			t.Errorf("expected existing query %d, got %d", created.ID, again.ID)
+		}
+		if jobs, err := d.ListScrapeJobs(t.Context(), created.ID); err != nil || len(jobs) != 2 {
+			t.Errorf("want 2 jobs for the filtered query, got %d (%v)", len(jobs), err)
+		}
+	})
+
+	t.Run("it only schedules the query sources", func(t *testing.T) {
+		created, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{
+			Keywords: "golang",
+			Location: "berlin",
+			Sources:  []string{"mock2"},
+		})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		jobs, err := d.ListScrapeJobs(t.Context(), created.ID)
+		if err != nil {
+			t.Fatalf("failed to list jobs: %s", err)
+		}
+		if len(jobs) != 1 || jobs[0].ScraperName != "mock2" {
+			t.Errorf("expected a single job for mock2, got %+v", jobs)
+		}
+	})
+
+	t.Run("with unknown source returns err", func(t *testing.T) {
+		_, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{
+			Keywords: "golang",
+			Location: "berlin",
+			Sources:  []string{"cuak"},
+		})
+		if !errors.Is(err, ErrUnknownSource) {
+			t.Errorf("wanted ErrUnknownSource, got: %v", err)
 		}
 	})
 }
 
-func TestCreateWithTimeOut(t *testing.T) {
+func TestCreateQueryProgress(t *testing.T) {
 	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
 	d, dbCloser := db.NewTestDB(t)
 	defer dbCloser()
@@ -114,24 +229,110 @@ func TestCreateWithTimeOut(t *testing.T) {
 		"mock2": scrape.Mock,
 		"mock3": scrape.MockWithErr,
 	}
-	j, jCloser := New(t.Context(), l, d, WithScrapeList(sl), WithTimeOut(time.Nanosecond))
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(sl))
 	defer jCloser()
-	err := j.CreateQuery(t.Context(), "cuak", "squeek")
-	if !errors.Is(err, ErrTimedOut) {
-		t.Errorf("wanted err to be ErrTimedOut, got: %v", err)
+
+	// The query is created right away while its scrapers run in the background.
+	start := time.Now()
+	q, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cuak", Location: "squeek"})
+	if err != nil {
+		t.Fatalf("wanted no error, got: %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("wanted CreateQuery not to wait for the scrapers, took %v", time.Since(start))
+	}
+	_, progress, err := j.Progress(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(progress) != 3 || Finished(progress) {
+		t.Errorf("wanted 3 unfinished scrapers, got %v", progress)
 	}
 
-	// Ensure new tasks were run immediately by checking if they
-	// were performed within the last second.
-	time.Sleep(200 * time.Millisecond)
-	for _, jb := range j.sched.Jobs() {
-		if slices.Contains(jb.Tags(), "cuaksqueek") {
-			lr, _ := jb.LastRunStartedAt() //nolint: errcheck
-			if lr.Before(time.Now().Add(-time.Second)) {
-				t.Errorf("expected created query to have been performed immediately, got %v", lr)
-			}
+	time.Sleep(300 * time.Millisecond)
+	_, progress, err = j.Progress(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]struct {
+		state  string
+		offers int32
+	}{
+		"mock":  {StateDone, 1},
+		"mock2": {StateDone, 1},
+		"mock3": {StateFailed, 0},
+	}
+	for _, p := range progress {
+		if w := want[p.ScraperName]; p.State != w.state || p.OfferCount != w.offers {
+			t.Errorf("wanted %s to be %s with %d offers, got %s with %d", p.ScraperName, w.state, w.offers, p.State, p.OfferCount)
 		}
 	}
+	if !Finished(progress) {
+		t.Errorf("wanted every scraper to be finished")
+	}
+
+	t.Run("unknown query", func(t *testing.T) {
+		_, _, err := j.Progress(t.Context(), pgtype.UUID{Bytes: uuid.New(), Valid: true})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("wanted sql.ErrNoRows, got: %v", err)
+		}
+	})
+}
+
+func TestCreateQueryCircuitOpen(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	sl := scrape.List{
+		"mock":  scrape.Mock,
+		"mock2": scrape.Mock,
+	}
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(sl))
+	defer jCloser()
+
+	// mock2's job portal is blocking us while the query is created.
+	for range breakerThreshold {
+		j.breakers["mock2"].done(l, errors.New("blocked"))
+	}
+
+	q, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cuak", Location: "squeek"})
+	if err != nil {
+		t.Fatalf("wanted no error, got: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	_, progress, err := j.Progress(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]struct {
+		state  string
+		reason string
+	}{
+		"mock":  {StateDone, ""},
+		"mock2": {StateFailed, "mock2 is temporarily unavailable"},
+	}
+	for _, p := range progress {
+		if w := want[p.ScraperName]; p.State != w.state || p.FailureReason != w.reason {
+			t.Errorf("wanted %s to be %s with reason %q, got %s with %q", p.ScraperName, w.state, w.reason, p.State, p.FailureReason)
+		}
+	}
+	if !Finished(progress) {
+		t.Errorf("wanted every scraper to be finished")
+	}
+
+	t.Run("skipped runs are recorded", func(t *testing.T) {
+		if err := j.runQuery(t.Context(), q.ID, "mock2"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("wanted ErrCircuitOpen, got: %v", err)
+		}
+		_, runs, err := j.ListRuns(t.Context(), q.PublicID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		i := slices.IndexFunc(runs, func(r *db.ScrapeRun) bool { return r.ScraperName == "mock2" })
+		if i < 0 || runs[i].Error != "skipped: scraper circuit is open" {
+			t.Errorf("wanted a skipped run of mock2, got %+v", runs)
+		}
+	})
 }
 
 func TestListOffers(t *testing.T) {
@@ -175,10 +376,15 @@ func TestListOffers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			o, _, err := j.ListOffers(context.Background(), &db.GetQueryParams{
-				Keywords: tt.keywords,
-				Location: tt.location,
-			})
+			// Non existent queries get a random public id.
+			id := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+			if q, err := d.GetQuery(context.Background(), &db.GetQueryParams{
+				KeywordsKey: tt.keywords,
+				LocationKey: tt.location,
+			}); err == nil {
+				id = q.PublicID
+			}
+			o, _, err := j.ListOffers(context.Background(), id, nil)
 			switch {
 			case err == nil:
 				if len(o) != tt.wantOffers {
@@ -191,6 +397,271 @@ func TestListOffers(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("offers are filtered by the query filters", func(t *testing.T) {
+		q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{
+			Keywords:     "golang",
+			Location:     "berlin",
+			TitleExclude: []string{"junior"},
+		})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		// Seed offers 2 and 3 are existing_offer and existing_offer2.
+		d.CreateQueryOfferAssoc(t.Context(), []*db.CreateQueryOfferAssocParams{
+			{QueryID: q.ID, OfferID: 2},
+			{QueryID: q.ID, OfferID: 3},
+		}).Exec(func(_ int, err error) {
+			if err != nil {
+				t.Fatalf("failed to create query offer association: %s", err)
+			}
+		})
+		o, _, err := j.ListOffers(t.Context(), q.PublicID, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 1 || o[0].ExternalID != "existing_offer2" {
+			t.Errorf("expected only the senior offer, got %v", o)
+		}
+	})
+
+	t.Run("offers are filtered by source", func(t *testing.T) {
+		q, err := d.GetQuery(t.Context(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		o, _, err := j.ListOffers(t.Context(), q.PublicID, []string{"Stepstone"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 1 || o[0].Source != "Stepstone" {
+			t.Errorf("expected only the Stepstone offer, got %v", o)
+		}
+	})
+
+	t.Run("offers from different sources are merged", func(t *testing.T) {
+		q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "rust", Location: "berlin"})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		now := time.Now()
+		offers := []db.CreateOfferParams{
+			{ExternalID: "1", Title: "Rust Developer (m/w/d)", Company: "Späti GmbH", Location: "Berlin, Germany", Source: "LinkedIn"},
+			{ExternalID: "1", Title: "Rust Developer", Company: "Späti", Location: "Berlin", Source: "Stepstone"},
+			{ExternalID: "2", Title: "Rust Developer", Company: "Späti", Location: "Hamburg", Source: "Stepstone"},
+		}
+		for i := range offers {
+			offers[i].PostedAt = pgtype.Timestamptz{Time: now.Add(-time.Duration(i) * time.Hour), Valid: true}
+		}
+		if _, err := j.saveOffers(t.Context(), q.ID, "Mock", offers); err != nil {
+			t.Fatalf("failed to save offers: %s", err)
+		}
+
+		o, _, err := j.ListOffers(t.Context(), q.PublicID, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 2 {
+			t.Fatalf("expected 2 offers, got %d", len(o))
+		}
+		if o[0].Source != "LinkedIn" || len(o[0].Duplicates) != 1 || o[0].Duplicates[0].Source != "Stepstone" {
+			t.Errorf("expected the LinkedIn offer with its Stepstone duplicate, got %v", o[0])
+		}
+		if o[1].Location != "Hamburg" || len(o[1].Duplicates) != 0 {
+			t.Errorf("expected the Hamburg offer without duplicates, got %v", o[1])
+		}
+	})
+
+	t.Run("offers from the same source are not merged", func(t *testing.T) {
+		q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "zig", Location: "berlin"})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		now := time.Now()
+		offers := []db.CreateOfferParams{
+			{ExternalID: "zig1", Title: "Zig Developer", Company: "Späti", Location: "Berlin", Source: "LinkedIn"},
+			{ExternalID: "zig2", Title: "Zig Developer (m/w/d)", Company: "Späti GmbH", Location: "Berlin", Source: "LinkedIn"},
+			{ExternalID: "zig1", Title: "Zig Developer", Company: "Späti", Location: "Berlin", Source: "Stepstone"},
+		}
+		for i := range offers {
+			offers[i].PostedAt = pgtype.Timestamptz{Time: now.Add(-time.Duration(i) * time.Hour), Valid: true}
+		}
+		if _, err := j.saveOffers(t.Context(), q.ID, "Mock", offers); err != nil {
+			t.Fatalf("failed to save offers: %s", err)
+		}
+
+		o, _, err := j.ListOffers(t.Context(), q.PublicID, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 2 {
+			t.Fatalf("expected the 2 LinkedIn offers to stay separate, got %d offers", len(o))
+		}
+		var duplicates int
+		for _, offer := range o {
+			if offer.Source != "LinkedIn" {
+				t.Errorf("expected both canonical offers to be from LinkedIn, got %s", offer.Source)
+			}
+			duplicates += len(offer.Duplicates)
+		}
+		if duplicates != 1 {
+			t.Errorf("expected the Stepstone offer to join one of them, got %d duplicates", duplicates)
+		}
+	})
+}
+
+func TestExportOffers(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(scrape.MockList), WithWorkers(0))
+	defer jCloser()
+
+	q, err := d.GetQuery(t.Context(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
+	if err != nil {
+		t.Fatalf("unable to retrieve seed query: %v", err)
+	}
+	// Closed offers are exported as well.
+	if err := d.UpdateOfferCheckedAt(t.Context(), &db.UpdateOfferCheckedAtParams{Closed: true, ID: 3}); err != nil {
+		t.Fatalf("unable to close offer: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		sources []string
+		want    []string
+	}{
+		{name: "every offer", want: []string{"existing_offer", "existing_offer2"}},
+		{name: "offers from the given sources", sources: []string{"Stepstone"}, want: []string{"existing_offer2"}},
+		{name: "no offers from the given sources", sources: []string{"Glassdoor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for page, err := range j.ExportOffers(t.Context(), q.ID, tt.sources) {
+				if err != nil {
+					t.Fatalf("wanted no error, got: %v", err)
+				}
+				for _, o := range page {
+					got = append(got, o.ExternalID)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("wanted offers %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFeedVersion(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(scrape.MockList))
+	defer jCloser()
+
+	t.Run("valid query", func(t *testing.T) {
+		gqp := &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"}
+		before, err := d.GetQuery(t.Context(), gqp)
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		v, err := j.FeedVersion(t.Context(), before.PublicID)
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if v.ID != before.ID {
+			t.Errorf("wanted query id %d, got %d", before.ID, v.ID)
+		}
+		if !v.UpdatedAt.Time.Equal(before.UpdatedAt.Time) {
+			t.Errorf("wanted UpdatedAt %v, got %v", before.UpdatedAt.Time, v.UpdatedAt.Time)
+		}
+		if !v.FeedUpdatedAt.Time.Equal(before.FeedUpdatedAt.Time) {
+			t.Errorf("wanted FeedUpdatedAt %v, got %v", before.FeedUpdatedAt.Time, v.FeedUpdatedAt.Time)
+		}
+		after, err := d.GetQuery(t.Context(), gqp)
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		if !after.QueriedAt.Time.After(before.QueriedAt.Time) {
+			t.Errorf("wanted QueriedAt to be updated")
+		}
+	})
+
+	t.Run("recently used query", func(t *testing.T) {
+		gqp := &db.GetQueryParams{KeywordsKey: "data scientist", LocationKey: "new york"}
+		before, err := d.GetQuery(t.Context(), gqp)
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		if _, err := j.FeedVersion(t.Context(), before.PublicID); err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		after, err := d.GetQuery(t.Context(), gqp)
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		if !after.QueriedAt.Time.Equal(before.QueriedAt.Time) {
+			t.Errorf("wanted QueriedAt not to be updated within the hour, got %v before and %v after", before.QueriedAt.Time, after.QueriedAt.Time)
+		}
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := j.FeedVersion(t.Context(), pgtype.UUID{Bytes: uuid.New(), Valid: true})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("wanted sql.ErrNoRows, got: %v", err)
+		}
+	})
+}
+
+func TestDeleteOldOffers(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(scrape.MockList))
+	defer jCloser()
+
+	q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cobol", Location: "berlin"})
+	if err != nil {
+		t.Fatalf("failed to create query: %s", err)
+	}
+	offers := []db.CreateOfferParams{{
+		ExternalID: "cobol1",
+		Title:      "Cobol Developer",
+		Company:    "Späti",
+		Location:   "Berlin",
+		Source:     "LinkedIn",
+		PostedAt:   pgtype.Timestamptz{Time: time.Now().Add(-8 * 24 * time.Hour), Valid: true},
+	}}
+	if _, err := j.saveOffers(t.Context(), q.ID, "Mock", offers); err != nil {
+		t.Fatalf("failed to save offers: %s", err)
+	}
+	before, err := j.FeedVersion(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := d.DeleteOldOffers(t.Context()); err != nil {
+		t.Fatalf("failed to delete old offers: %s", err)
+	}
+	after, err := j.FeedVersion(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	o, _, err := j.ListOffers(t.Context(), q.PublicID, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(o) != 0 {
+		t.Errorf("wanted the old offer to be deleted, got %d offers", len(o))
+	}
+	if !after.FeedUpdatedAt.Valid || (before.FeedUpdatedAt.Valid && !after.FeedUpdatedAt.Time.After(before.FeedUpdatedAt.Time)) {
+		t.Errorf("wanted FeedUpdatedAt to be bumped, got %v before and %v after", before.FeedUpdatedAt, after.FeedUpdatedAt)
+	}
+	if !after.UpdatedAt.Time.Equal(before.UpdatedAt.Time) {
+		t.Errorf("wanted UpdatedAt to keep the last scrape time, got %v before and %v after", before.UpdatedAt, after.UpdatedAt)
+	}
 }
 
 func TestRunQuery(t *testing.T) {
@@ -211,12 +682,12 @@ func TestRunQuery(t *testing.T) {
 		j.runQuery(t.Context(), q.ID, mockScraperName)
 
 		t.Run("it calls the scraper", func(t *testing.T) {
-			if *mockScraper.LastQuery != *q {
+			if !reflect.DeepEqual(mockScraper.LastQuery, q) {
 				t.Errorf("wanted ran query to be %v, got %v", q, mockScraper.LastQuery)
 			}
 		})
 		t.Run("it updates the UpdatedAt field used for removing old queries", func(t *testing.T) {
-			qq, err := d.GetQuery(context.Background(), &db.GetQueryParams{Keywords: "golang", Location: "berlin"})
+			qq, err := d.GetQuery(context.Background(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
 			if err != nil {
 				t.Errorf("unable to retrieve seed query: %v", err)
 			}
@@ -227,15 +698,184 @@ func TestRunQuery(t *testing.T) {
 		// TODO: test adding offer and ignoring existing offer
 	})
 
+	t.Run("it records the scraper state", func(t *testing.T) {
+		status, err := d.ListQueryScraperStatus(t.Context(), 3)
+		if err != nil {
+			t.Fatalf("unable to list scraper status: %v", err)
+		}
+		if len(status) != 1 || status[0].State != StateDone || status[0].OfferCount != 1 {
+			t.Errorf("wanted the Mock scraper to be done with 1 offer, got %v", status)
+		}
+	})
+
+	t.Run("it records the run", func(t *testing.T) {
+		q, err := d.GetQueryByID(t.Context(), 3)
+		if err != nil {
+			t.Fatalf("unable to retrieve seed query: %v", err)
+		}
+		// A second run finds the same offer again.
+		j.runQuery(t.Context(), q.ID, mockScraperName)
+
+		_, runs, err := j.ListRuns(t.Context(), q.PublicID)
+		if err != nil {
+			t.Fatalf("unable to list runs: %v", err)
+		}
+		if len(runs) != 2 {
+			t.Fatalf("wanted 2 runs, got %d", len(runs))
+		}
+		want := []struct{ pages, offers, newOffers int32 }{{1, 1, 0}, {1, 1, 1}} // Newest first.
+		for i, r := range runs {
+			if r.ScraperName != mockScraperName || r.Pages != want[i].pages || r.Offers != want[i].offers || r.NewOffers != want[i].newOffers {
+				t.Errorf("wanted run %d to be %+v, got %+v", i, want[i], r)
+			}
+			if r.Error != "" || r.FinishedAt.Time.Before(r.StartedAt.Time) {
+				t.Errorf("wanted run %d to finish without errors, got %+v", i, r)
+			}
+		}
+	})
+
+	t.Run("offers with the same id from different sources don't collide", func(t *testing.T) {
+		ids := map[int64]bool{}
+		now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		var params []*db.CreateOfferParams
+		for _, source := range []string{"Stepstone", "Glassdoor", "Stepstone"} {
+			params = append(params, &db.CreateOfferParams{ExternalID: "12345", Title: "Golang Dweeb", PostedAt: now, Source: source})
+		}
+		d.CreateOffer(t.Context(), params).QueryRow(func(_ int, o *db.CreateOfferRow, err error) {
+			if err != nil {
+				t.Fatalf("unable to create offer: %v", err)
+			}
+			ids[o.ID] = true
+		})
+		if len(ids) != 2 {
+			t.Errorf("wanted 2 offers, got %d", len(ids))
+		}
+	})
+
+	t.Run("upserted offers return their previous values", func(t *testing.T) {
+		postedAt := time.Now()
+		created := &db.CreateOfferParams{
+			ExternalID: "67890",
+			Title:      "Golang Dweeb",
+			PostedAt:   pgtype.Timestamptz{Time: postedAt, Valid: true},
+			Source:     "Stepstone",
+		}
+		updated := &db.CreateOfferParams{
+			ExternalID: "67890",
+			Title:      "Senior Golang Dweeb",
+			PostedAt:   pgtype.Timestamptz{Time: postedAt.Add(-time.Hour), Valid: true},
+			Source:     "Stepstone",
+		}
+		var rows []*db.CreateOfferRow
+		d.CreateOffer(t.Context(), []*db.CreateOfferParams{created, updated}).QueryRow(func(_ int, o *db.CreateOfferRow, err error) {
+			if err != nil {
+				t.Fatalf("unable to upsert offer: %v", err)
+			}
+			rows = append(rows, o)
+		})
+		if rows[0].PreviousTitle.Valid {
+			t.Errorf("wanted no previous values for a new offer, got %v", rows[0])
+		}
+		if rows[1].ID != rows[0].ID || rows[1].PreviousTitle.String != "Golang Dweeb" {
+			t.Errorf("wanted offer %d with previous title, got %v", rows[0].ID, rows[1])
+		}
+		if fields := offerChanges(rows[1], updated); !slices.Equal(fields, []string{"title"}) {
+			t.Errorf("wanted only the title to change, got %v", fields)
+		}
+	})
+
+	t.Run("offers are saved atomically", func(t *testing.T) {
+		q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "zig", Location: "berlin"})
+		if err != nil {
+			t.Fatalf("failed to create query: %s", err)
+		}
+		_, err = j.saveOffers(t.Context(), q.ID, mockScraperName, []db.CreateOfferParams{
+			{ExternalID: "zig1", Title: "Zig Developer", PostedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}, Source: "Mock"},
+			{ExternalID: "zig2", Title: "Zig Developer"}, // Missing the posting date.
+		})
+		if err == nil {
+			t.Fatal("wanted an error saving an invalid offer")
+		}
+		o, err := d.ListOffers(t.Context(), q.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 0 {
+			t.Errorf("wanted no offers saved, got %d", len(o))
+		}
+		qq, err := d.GetQueryByID(t.Context(), q.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if qq.UpdatedAt.Valid {
+			t.Errorf("wanted the query timestamp not to be updated, got %v", qq.UpdatedAt.Time)
+		}
+	})
+
 	t.Run("with older than 7 days query deletes the query", func(t *testing.T) {
-		q, err := d.GetQuery(context.Background(), &db.GetQueryParams{Keywords: "python", Location: "san francisco"})
+		q, err := d.GetQuery(context.Background(), &db.GetQueryParams{KeywordsKey: "python", LocationKey: "san francisco"})
 		if err != nil {
 			t.Errorf("unable to retrieve seed query: %v", err)
 		}
 		j.runQuery(t.Context(), q.ID, mockScraperName)
-		_, err = d.GetQuery(context.Background(), &db.GetQueryParams{Keywords: "python", Location: "san francisco"})
+		_, err = d.GetQuery(context.Background(), &db.GetQueryParams{KeywordsKey: "python", LocationKey: "san francisco"})
 		if !errors.Is(err, sql.ErrNoRows) {
 			t.Errorf("query should have been deleted but got: %v", err)
 		}
 	})
 }
+
+func TestCheckOffers(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	scrape.Mock.GoneURLs = []string{"https://www.stepstone.de/senior_golang_dweeb"}
+	defer func() { scrape.Mock.GoneURLs = nil }()
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(scrape.List{"Stepstone": scrape.Mock}))
+	defer jCloser()
+
+	q, err := d.GetQuery(t.Context(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
+	if err != nil {
+		t.Fatalf("unable to retrieve seed query: %v", err)
+	}
+	before, err := j.FeedVersion(t.Context(), q.PublicID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Only existing_offer2 hasn't been seen in a day.
+	j.checkOffers(t.Context())
+
+	t.Run("closed offers are hidden from the feeds", func(t *testing.T) {
+		o, _, err := j.ListOffers(t.Context(), q.PublicID, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 1 || o[0].ExternalID != "existing_offer" {
+			t.Errorf("expected only the open offer, got %v", o)
+		}
+	})
+
+	t.Run("closed offers change the feed version", func(t *testing.T) {
+		after, err := j.FeedVersion(t.Context(), q.PublicID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !after.FeedUpdatedAt.Time.After(before.FeedUpdatedAt.Time) {
+			t.Errorf("wanted FeedUpdatedAt to be bumped, got %v before and %v after", before.FeedUpdatedAt.Time, after.FeedUpdatedAt.Time)
+		}
+		if !after.UpdatedAt.Time.Equal(before.UpdatedAt.Time) {
+			t.Errorf("wanted UpdatedAt to keep the last scrape time, got %v before and %v after", before.UpdatedAt.Time, after.UpdatedAt.Time)
+		}
+	})
+
+	t.Run("checked offers aren't checked again", func(t *testing.T) {
+		o, err := d.ListOffersToCheck(t.Context(), checkBatchSize)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(o) != 0 {
+			t.Errorf("expected no offers to check, got %v", o)
+		}
+	})
+}
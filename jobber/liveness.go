@@ -0,0 +1,63 @@
+package jobber
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/metrics"
+	"github.com/alwedo/jobber/scrape"
+	"github.com/go-co-op/gocron/v2"
+)
+
+// checkBatchSize is the max amount of offers checked every run.
+const checkBatchSize = 200
+
+func (j *Jobber) schedCheckOffers() {
+	_, err := j.sched.NewJob(
+		gocron.CronJob("30 * * * *", false), // Every hour at minute 30.
+		gocron.NewTask(func() { j.checkOffers(j.ctx) }),
+		gocron.WithName("check-offers"),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		j.logger.Error("unable to schedule checkOffers job", slog.String("error", err.Error()))
+	}
+}
+
+// checkOffers asks the scrapers whether the offers no query has
+// seen lately are still published, closing the ones taken down.
+// Offers whose state can't be told are checked again the next day.
+func (j *Jobber) checkOffers(ctx context.Context) {
+	offers, err := j.db.ListOffersToCheck(ctx, checkBatchSize)
+	if err != nil {
+		j.logger.Error("unable to list offers to check in jobber.checkOffers", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, o := range offers {
+		if ctx.Err() != nil {
+			return
+		}
+		logAttr := []any{slog.Int64("offerID", o.ID), slog.String("source", o.Source)}
+
+		var closed bool
+		state := "unknown"
+		if c, ok := j.scrList[o.Source].(scrape.Checker); ok {
+			gone, err := c.IsGone(ctx, o.Url)
+			switch {
+			case err != nil:
+				j.logger.Warn("unable to check offer in jobber.checkOffers", append(logAttr, slog.String("error", err.Error()))...)
+			case gone:
+				closed, state = true, "closed"
+			default:
+				state = "open"
+			}
+		}
+		metrics.JobberCheckedOffers.WithLabelValues(o.Source, state).Inc()
+
+		if err := j.db.UpdateOfferCheckedAt(ctx, &db.UpdateOfferCheckedAtParams{Closed: closed, ID: o.ID}); err != nil {
+			j.logger.Error("unable to update offer in jobber.checkOffers", append(logAttr, slog.String("error", err.Error()))...)
+		}
+	}
+}
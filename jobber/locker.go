@@ -0,0 +1,76 @@
+package jobber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// lockTTL is the longest a job holds its lock, which bounds for how
+	// long a job stays locked when its instance dies while running it.
+	lockTTL = time.Hour
+	// lockMinHold is the shortest a job holds its lock. The instances fire
+	// the same jobs at the same minute, so it covers their clock drift.
+	lockMinHold = time.Minute
+)
+
+var ErrJobLocked = errors.New("job is locked by another instance")
+
+// WithDistributedLocks coordinates several jobber instances sharing the
+// database, ie. behind a load balancer, so only one of them runs a given
+// maintenance job at a time. Every instance schedules them and the first
+// one to lock a job runs it. The scrapes are coordinated by their queue.
+func WithDistributedLocks() Options {
+	return func(j *Jobber) {
+		j.locker = &dbLocker{db: j.db, ttl: lockTTL, minHold: lockMinHold}
+	}
+}
+
+// dbLocker is a gocron.Locker backed by leases in the job_locks table.
+// Unlike advisory locks they don't tie up a pooled connection while the
+// job runs, and they survive the instance holding them long enough to
+// tell apart the runs of different instances.
+type dbLocker struct {
+	db      *db.Queries
+	ttl     time.Duration
+	minHold time.Duration
+}
+
+func (l *dbLocker) Lock(ctx context.Context, key string) (gocron.Lock, error) {
+	token, err := l.db.AcquireJobLock(ctx, &db.AcquireJobLockParams{Key: key, Ttl: interval(l.ttl)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrJobLocked, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire job lock in jobber.dbLocker.Lock: %w", err)
+	}
+	return &dbLock{locker: l, key: key, token: token}, nil
+}
+
+type dbLock struct {
+	locker *dbLocker
+	key    string
+	token  pgtype.UUID
+}
+
+func (l *dbLock) Unlock(ctx context.Context) error {
+	if err := l.locker.db.ReleaseJobLock(ctx, &db.ReleaseJobLockParams{
+		MinHold: interval(l.locker.minHold),
+		Key:     l.key,
+		Token:   l.token,
+	}); err != nil {
+		return fmt.Errorf("failed to release job lock in jobber.dbLock.Unlock: %w", err)
+	}
+	return nil
+}
+
+func interval(d time.Duration) pgtype.Interval {
+	return pgtype.Interval{Microseconds: d.Microseconds(), Valid: true}
+}
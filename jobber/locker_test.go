@@ -0,0 +1,67 @@
+package jobber
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+)
+
+func TestDistributedLocks(t *testing.T) {
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+
+	t.Run("a locked job can't be locked again until unlocked", func(t *testing.T) {
+		l := &dbLocker{db: d, ttl: time.Hour}
+		lock, err := l.Lock(t.Context(), "query-1-mock")
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if _, err := l.Lock(t.Context(), "query-1-mock"); !errors.Is(err, ErrJobLocked) {
+			t.Errorf("wanted ErrJobLocked, got: %v", err)
+		}
+		if _, err := l.Lock(t.Context(), "query-1-mock2"); err != nil {
+			t.Errorf("wanted other jobs to be unlocked, got: %v", err)
+		}
+		if err := lock.Unlock(t.Context()); err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if _, err := l.Lock(t.Context(), "query-1-mock"); err != nil {
+			t.Errorf("wanted no error, got: %v", err)
+		}
+	})
+
+	t.Run("unlocked jobs are held for a minimum time", func(t *testing.T) {
+		l := &dbLocker{db: d, ttl: time.Hour, minHold: time.Hour}
+		lock, err := l.Lock(t.Context(), "check-offers")
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if err := lock.Unlock(t.Context()); err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if _, err := l.Lock(t.Context(), "check-offers"); !errors.Is(err, ErrJobLocked) {
+			t.Errorf("wanted ErrJobLocked, got: %v", err)
+		}
+	})
+
+	t.Run("expired locks can be taken over", func(t *testing.T) {
+		expired := &dbLocker{db: d, ttl: -time.Second}
+		stale, err := expired.Lock(t.Context(), "delete-old-offers")
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		l := &dbLocker{db: d, ttl: time.Hour}
+		if _, err := l.Lock(t.Context(), "delete-old-offers"); err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		// The stale lock can't release the new holder's one.
+		if err := stale.Unlock(t.Context()); err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if _, err := l.Lock(t.Context(), "delete-old-offers"); !errors.Is(err, ErrJobLocked) {
+			t.Errorf("wanted ErrJobLocked, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package jobber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// States of the last run of a query with a scraper.
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+// Progress returns the query for the given public id along with the state
+// of its last run with each of its scrapers, so the progress of a newly
+// created query can be followed while its offers arrive.
+// Returns sql.ErrNoRows for non-existent query.
+func (j *Jobber) Progress(ctx context.Context, publicID pgtype.UUID) (*db.Query, []*db.QueryScraperStatus, error) {
+	q, err := j.db.GetQueryByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting query in jobber.Progress: %w", err)
+	}
+	status, err := j.db.ListQueryScraperStatus(ctx, q.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing scraper status in jobber.Progress: %w", err)
+	}
+	byScraper := make(map[string]*db.QueryScraperStatus, len(status))
+	for _, s := range status {
+		byScraper[s.ScraperName] = s
+	}
+
+	// Scrapers only get a status once they first run the query, and those
+	// with an open circuit won't run it until they cool down, so they are
+	// reported as failed rather than leaving the query pending meanwhile.
+	var progress []*db.QueryScraperStatus
+	for _, name := range j.querySources(q.Sources) {
+		s, ok := byScraper[name]
+		if !ok {
+			s = &db.QueryScraperStatus{QueryID: q.ID, ScraperName: name, State: StatePending}
+		}
+		if s.State == StatePending && j.breakers[name].blocked() {
+			s.State, s.FailureReason = StateFailed, unavailableReason(name)
+		}
+		progress = append(progress, s)
+	}
+	return q, progress, nil
+}
+
+// Finished tells whether every scraper of a query's progress is done or failed.
+func Finished(progress []*db.QueryScraperStatus) bool {
+	for _, s := range progress {
+		if s.State != StateDone && s.State != StateFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// setState records the state of the query's run with the scraper.
+// Failing to do so doesn't stop the run, so errors are only logged.
+func (j *Jobber) setState(ctx context.Context, qID int64, scraperName, state string, offers int, reason string) {
+	if err := j.db.UpdateQueryScraperState(ctx, &db.UpdateQueryScraperStateParams{
+		QueryID:       qID,
+		ScraperName:   scraperName,
+		State:         state,
+		OfferCount:    int32(offers), //nolint: gosec // scrapes are way below int32 offers.
+		FailureReason: reason,
+	}); err != nil {
+		j.logger.Error("unable to update scraper state in jobber.setState",
+			slog.Int64("queryID", qID),
+			slog.String("scraper", scraperName),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// unavailableReason is the failure reason of a scraper whose circuit is open.
+func unavailableReason(scraperName string) string {
+	return scraperName + " is temporarily unavailable"
+}
+
+// failureReason describes a scrape error in terms fit to show to users.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "the search was interrupted"
+	case errors.Is(err, retryhttp.ErrRetryable):
+		return "the job portal kept rejecting our requests"
+	default:
+		return "the job portal returned an unexpected response"
+	}
+}
@@ -0,0 +1,190 @@
+package jobber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// jobLease is how long a worker holds a claimed job. The jobs of
+	// workers that died are claimed again once it expires, so it needs
+	// to be longer than any scrape.
+	jobLease = time.Hour
+	// pollInterval is how often idle workers look for due jobs.
+	pollInterval = 10 * time.Second
+	// baseBackoff is the delay before retrying a job that failed once.
+	// It doubles with every consecutive failure, up to the job's policy.
+	baseBackoff = 5 * time.Minute
+	// priorityNew makes the first run of new queries jump ahead of the
+	// scheduled ones, since their users are waiting for the offers.
+	priorityNew = 10
+	// defaultWorkers is how many jobs an instance runs at once.
+	defaultWorkers = 8
+)
+
+// Policy returns when a job runs next after a successful run that was due at the given time.
+type Policy func(due time.Time) time.Time
+
+// Every runs the jobs on a fixed interval, keeping them at the same
+// minute so they stay spread along the interval. Runs missed while no
+// instance was up are skipped. Every(time.Hour) is the default policy.
+func Every(d time.Duration) Policy {
+	return func(due time.Time) time.Time {
+		next := due.Add(d)
+		if now := time.Now(); next.Before(now) {
+			next = next.Add(now.Sub(next).Truncate(d) + d)
+		}
+		return next
+	}
+}
+
+// WithPolicy sets when the queries run again after running.
+func WithPolicy(p Policy) Options {
+	return func(j *Jobber) {
+		j.policy = p
+	}
+}
+
+// WithWorkers sets how many jobs this instance runs at once.
+func WithWorkers(n int) Options {
+	return func(j *Jobber) {
+		j.workers = n
+	}
+}
+
+// enqueueQuery adds the query's scrapers to the work queue, due at the given time.
+func (j *Jobber) enqueueQuery(ctx context.Context, q *db.Query, priority int32, at time.Time) error {
+	var jobs []*db.EnqueueScrapeJobParams
+	for _, name := range j.querySources(q.Sources) {
+		jobs = append(jobs, &db.EnqueueScrapeJobParams{
+			QueryID:     q.ID,
+			ScraperName: name,
+			Priority:    priority,
+			NextRunAt:   pgtype.Timestamptz{Time: at, Valid: true},
+		})
+	}
+	var batchErr error
+	j.db.EnqueueScrapeJob(ctx, jobs).Exec(func(_ int, err error) {
+		if batchErr == nil {
+			batchErr = err
+		}
+	})
+	if batchErr != nil {
+		return fmt.Errorf("failed to enqueue scrape jobs in jobber.enqueueQuery: %w", batchErr)
+	}
+	// Jobs already queued aren't added again, so the gauge is set from
+	// the queue instead of the batch.
+	n, err := j.db.CountScrapeJobs(ctx, q.ID)
+	if err != nil {
+		return fmt.Errorf("failed to count scrape jobs in jobber.enqueueQuery: %w", err)
+	}
+	metrics.JobberScheduledQueries.WithLabelValues(fmt.Sprintf("%d", q.ID), q.Keywords+q.Location, "").Set(float64(n))
+	return nil
+}
+
+// startWorkers runs the workers until the jobber's context is done.
+// The returned func waits for them to finish their running jobs.
+func (j *Jobber) startWorkers() func() {
+	done := make(chan struct{})
+	for range j.workers {
+		go func() {
+			j.work()
+			done <- struct{}{}
+		}()
+	}
+	return func() {
+		for range j.workers {
+			<-done
+		}
+	}
+}
+
+// work runs due jobs until there are none left, then waits for
+// more to be due or for new queries to be enqueued.
+func (j *Jobber) work() {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		for j.ctx.Err() == nil && j.runNextJob(j.ctx) {
+		}
+		select {
+		case <-j.ctx.Done():
+			return
+		case <-t.C:
+		case <-j.wake:
+		}
+	}
+}
+
+// notify wakes up an idle worker, if any.
+func (j *Jobber) notify() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runNextJob claims the most urgent due job, runs it and reschedules it.
+// It tells whether there was a job to run.
+func (j *Jobber) runNextJob(ctx context.Context) bool {
+	job, err := j.db.ClaimScrapeJob(ctx, &db.ClaimScrapeJobParams{Lease: interval(jobLease), Skip: j.blockedScrapers()})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			j.logger.Error("unable to claim scrape job in jobber.runNextJob", slog.String("error", err.Error()))
+		}
+		return false
+	}
+	// There might be more due jobs for the idle workers.
+	j.notify()
+	metrics.JobberScrapeJobDelay.WithLabelValues(job.ScraperName).Observe(time.Since(job.NextRunAt.Time).Seconds())
+
+	runErr := j.runQuery(ctx, job.QueryID, job.ScraperName)
+
+	next := &db.FinishScrapeJobParams{
+		QueryID:     job.QueryID,
+		ScraperName: job.ScraperName,
+		LockedUntil: job.LockedUntil,
+	}
+	switch {
+	case ctx.Err() != nil, errors.Is(runErr, ErrCircuitOpen):
+		// The instance is shutting down, or the scraper's circuit opened
+		// after the job was claimed, so the job is released untouched
+		// for it to run as soon as possible.
+		next.NextRunAt, next.Attempts, next.LastError = job.NextRunAt, job.Attempts, job.LastError
+	case runErr != nil:
+		next.Attempts = job.Attempts + 1
+		next.LastError = runErr.Error()
+		next.NextRunAt = pgtype.Timestamptz{Time: j.retryAt(job.NextRunAt.Time, next.Attempts), Valid: true}
+	default:
+		next.NextRunAt = pgtype.Timestamptz{Time: j.policy(job.NextRunAt.Time), Valid: true}
+	}
+	if err := j.db.FinishScrapeJob(context.WithoutCancel(ctx), next); err != nil {
+		j.logger.Error("unable to finish scrape job in jobber.runNextJob",
+			slog.Int64("queryID", job.QueryID),
+			slog.String("scraper", job.ScraperName),
+			slog.String("error", err.Error()),
+		)
+	}
+	return true
+}
+
+// retryAt returns when a failed job is retried, backing off exponentially
+// with its consecutive failures but never later than its regular run.
+func (j *Jobber) retryAt(due time.Time, attempts int32) time.Time {
+	retry := time.Now().Add(baseBackoff << min(attempts-1, 10))
+	if next := j.policy(due); next.Before(retry) {
+		return next
+	}
+	return retry
+}
@@ -0,0 +1,154 @@
+package jobber
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/metrics"
+	"github.com/alwedo/jobber/scrape"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEvery(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		due  time.Time
+		want time.Time
+	}{
+		{name: "run on time", due: now, want: now.Add(time.Hour)},
+		{name: "late run keeps its minute", due: now.Add(-10 * time.Minute), want: now.Add(50 * time.Minute)},
+		{name: "missed runs are skipped", due: now.Add(-25*time.Hour - 10*time.Minute), want: now.Add(50 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Every(time.Hour)(tt.due); got.Sub(tt.want).Abs() > time.Second {
+				t.Errorf("wanted next run at %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryAt(t *testing.T) {
+	j := &Jobber{policy: Every(time.Hour)}
+	now := time.Now()
+	tests := []struct {
+		name     string
+		attempts int32
+		want     time.Time
+	}{
+		{name: "first failure", attempts: 1, want: now.Add(baseBackoff)},
+		{name: "backs off exponentially", attempts: 3, want: now.Add(4 * baseBackoff)},
+		{name: "never later than the regular run", attempts: 8, want: now.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := j.retryAt(now, tt.attempts); got.Sub(tt.want).Abs() > time.Second {
+				t.Errorf("wanted retry at %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScrapeQueue(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	// No workers so the test runs the jobs itself.
+	j, jCloser := New(t.Context(), l, d, WithScrapeList(scrape.List{"mock": scrape.Mock, "mock2": scrape.MockWithErr}), WithWorkers(0))
+	defer jCloser()
+
+	// A scheduled query due before the new one.
+	old, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "golang", Location: "hamburg"})
+	if err != nil {
+		t.Fatalf("failed to create query: %v", err)
+	}
+	if err := j.enqueueQuery(t.Context(), old, 0, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to enqueue query: %v", err)
+	}
+	created, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cuak", Location: "squeek"})
+	if err != nil {
+		t.Fatalf("failed to create query: %v", err)
+	}
+
+	t.Run("new queries run first", func(t *testing.T) {
+		for range 2 {
+			job, err := d.ClaimScrapeJob(t.Context(), &db.ClaimScrapeJobParams{Lease: interval(time.Hour)})
+			if err != nil {
+				t.Fatalf("wanted no error, got: %v", err)
+			}
+			if job.QueryID != created.ID || job.Priority != priorityNew {
+				t.Errorf("wanted a job of the new query, got %+v", job)
+			}
+		}
+	})
+
+	t.Run("claimed jobs aren't claimed again", func(t *testing.T) {
+		// The scheduled query's jobs are the only ones due, claimed jobs aside.
+		if !j.runNextJob(t.Context()) || !j.runNextJob(t.Context()) {
+			t.Fatal("wanted the scheduled query's jobs to run")
+		}
+		if j.runNextJob(t.Context()) {
+			t.Error("wanted no more due jobs")
+		}
+	})
+
+	t.Run("jobs are rescheduled after running", func(t *testing.T) {
+		jobs, err := d.ListScrapeJobs(t.Context(), old.ID)
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		for _, jb := range jobs {
+			if jb.LockedUntil.Valid {
+				t.Errorf("wanted %s to be released", jb.ScraperName)
+			}
+			switch jb.ScraperName {
+			case "mock":
+				if jb.Attempts != 0 || time.Until(jb.NextRunAt.Time) < 59*time.Minute {
+					t.Errorf("wanted mock to run again in an hour, got %+v", jb)
+				}
+			case "mock2":
+				if jb.Attempts != 1 || jb.LastError == "" || time.Until(jb.NextRunAt.Time) > baseBackoff {
+					t.Errorf("wanted mock2 to be retried after its failure, got %+v", jb)
+				}
+			}
+		}
+	})
+
+	t.Run("queued jobs are counted once", func(t *testing.T) {
+		if err := j.enqueueQuery(t.Context(), old, 0, time.Now()); err != nil {
+			t.Fatalf("failed to enqueue query: %v", err)
+		}
+		g := metrics.JobberScheduledQueries.WithLabelValues(fmt.Sprintf("%d", old.ID), old.Keywords+old.Location, "")
+		if got := testutil.ToFloat64(g); got != 2 {
+			t.Errorf("wanted 2 scheduled jobs, got %v", got)
+		}
+	})
+
+	t.Run("expired leases are claimed again", func(t *testing.T) {
+		q, err := d.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "golang", Location: "munich", Sources: []string{"mock"}})
+		if err != nil {
+			t.Fatalf("failed to create query: %v", err)
+		}
+		if err := j.enqueueQuery(t.Context(), q, 0, time.Now()); err != nil {
+			t.Fatalf("failed to enqueue query: %v", err)
+		}
+		stale, err := d.ClaimScrapeJob(t.Context(), &db.ClaimScrapeJobParams{Lease: interval(-time.Second)})
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		job, err := d.ClaimScrapeJob(t.Context(), &db.ClaimScrapeJobParams{Lease: interval(time.Hour)})
+		if err != nil {
+			t.Fatalf("wanted no error, got: %v", err)
+		}
+		if job.QueryID != stale.QueryID || job.ScraperName != stale.ScraperName {
+			t.Errorf("wanted %+v to be claimed again, got %+v", stale, job)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package jobber
+
+import (
+	"time"
+
+	"github.com/alwedo/jobber/db"
+)
+
+// repostThreshold is how far apart the posting dates of an offer need to
+// be to consider it reposted. Some portals only give the age in days of
+// their offers so smaller differences are just rounding.
+// It's mirrored in the CreateOffer query.
+const repostThreshold = 24 * time.Hour
+
+// offerChanges returns the names of the fields that changed between the
+// previous values of an upserted offer and the scraped one, or nil if
+// the offer is new.
+func offerChanges(prev *db.CreateOfferRow, o *db.CreateOfferParams) []string {
+	if !prev.PreviousTitle.Valid {
+		return nil
+	}
+
+	var fields []string
+	for _, f := range []struct {
+		name     string
+		old, new string
+	}{
+		{"title", prev.PreviousTitle.String, o.Title},
+		{"company", prev.PreviousCompany.String, o.Company},
+		{"location", prev.PreviousLocation.String, o.Location},
+		{"description", prev.PreviousDescription.String, o.Description},
+		{"url", prev.PreviousUrl.String, o.Url},
+	} {
+		if f.old != f.new {
+			fields = append(fields, f.name)
+		}
+	}
+	if o.PostedAt.Time.Sub(prev.PreviousPostedAt.Time).Abs() >= repostThreshold {
+		fields = append(fields, "posted_at")
+	}
+	return fields
+}
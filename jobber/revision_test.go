@@ -0,0 +1,97 @@
+package jobber
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestOfferChanges(t *testing.T) {
+	postedAt := time.Now()
+	prev := &db.CreateOfferRow{
+		PreviousTitle:       pgtype.Text{String: "Golang Dweeb", Valid: true},
+		PreviousCompany:     pgtype.Text{String: "Späti GmbH", Valid: true},
+		PreviousLocation:    pgtype.Text{String: "Berlin", Valid: true},
+		PreviousPostedAt:    pgtype.Timestamptz{Time: postedAt, Valid: true},
+		PreviousDescription: pgtype.Text{String: "some nifty description", Valid: true},
+		PreviousUrl:         pgtype.Text{String: "https://www.stepstone.de/golang_dweeb", Valid: true},
+	}
+	offer := func(f func(o *db.CreateOfferParams)) *db.CreateOfferParams {
+		o := &db.CreateOfferParams{
+			Title:       "Golang Dweeb",
+			Company:     "Späti GmbH",
+			Location:    "Berlin",
+			PostedAt:    pgtype.Timestamptz{Time: postedAt, Valid: true},
+			Description: "some nifty description",
+			Url:         "https://www.stepstone.de/golang_dweeb",
+		}
+		if f != nil {
+			f(o)
+		}
+		return o
+	}
+
+	tests := []struct {
+		name  string
+		prev  *db.CreateOfferRow
+		offer *db.CreateOfferParams
+		want  []string
+	}{
+		{
+			name:  "new offer",
+			prev:  &db.CreateOfferRow{ID: 1},
+			offer: offer(nil),
+			want:  nil,
+		},
+		{
+			name:  "unchanged offer",
+			prev:  prev,
+			offer: offer(nil),
+			want:  nil,
+		},
+		{
+			name: "changed title and description",
+			prev: prev,
+			offer: offer(func(o *db.CreateOfferParams) {
+				o.Title = "Senior Golang Dweeb"
+				o.Description = "an even niftier description"
+			}),
+			want: []string{"title", "description"},
+		},
+		{
+			name: "changed location",
+			prev: prev,
+			offer: offer(func(o *db.CreateOfferParams) {
+				o.Location = "Berlin, Germany"
+			}),
+			want: []string{"location"},
+		},
+		{
+			name: "posting date rounded to days",
+			prev: prev,
+			offer: offer(func(o *db.CreateOfferParams) {
+				o.PostedAt.Time = postedAt.Add(-23 * time.Hour)
+			}),
+			want: nil,
+		},
+		{
+			name: "reposted offer",
+			prev: prev,
+			offer: offer(func(o *db.CreateOfferParams) {
+				o.PostedAt.Time = postedAt.AddDate(0, 0, 3)
+			}),
+			want: []string{"posted_at"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offerChanges(tt.prev, tt.offer); !slices.Equal(got, tt.want) {
+				t.Errorf("wanted changes %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
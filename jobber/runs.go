@@ -0,0 +1,49 @@
+package jobber
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxRuns is how many of the latest runs ListRuns returns.
+const maxRuns = 24
+
+// ListRuns returns the query for the given public id along with its
+// latest scraper runs, newest first, to tell what happened when its
+// feed isn't showing the expected offers.
+// Returns sql.ErrNoRows for non-existent query.
+func (j *Jobber) ListRuns(ctx context.Context, publicID pgtype.UUID) (*db.Query, []*db.ScrapeRun, error) {
+	q, err := j.db.GetQueryByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting query in jobber.ListRuns: %w", err)
+	}
+	runs, err := j.db.ListScrapeRuns(ctx, &db.ListScrapeRunsParams{QueryID: q.ID, Limit: maxRuns})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing scrape runs in jobber.ListRuns: %w", err)
+	}
+	return q, runs, nil
+}
+
+// recordRun saves the outcome of a run. Runs interrupted by a shutdown
+// are recorded too, so it doesn't use the run's context.
+// Failing to do so doesn't affect the run, so errors are only logged.
+func (j *Jobber) recordRun(ctx context.Context, run *db.CreateScrapeRunParams, stats *retryhttp.Stats, err error) {
+	run.FinishedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	run.HttpStatuses = stats.String()
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if err := j.db.CreateScrapeRun(context.WithoutCancel(ctx), run); err != nil {
+		j.logger.Error("unable to record scrape run in jobber.recordRun",
+			slog.Int64("queryID", run.QueryID),
+			slog.String("scraper", run.ScraperName),
+			slog.String("error", err.Error()),
+		)
+	}
+}
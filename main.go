@@ -13,6 +13,7 @@ import (
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/jobber"
 	"github.com/alwedo/jobber/metrics"
+	"github.com/alwedo/jobber/scrape"
 	"github.com/alwedo/jobber/server"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "golang.org/x/crypto/x509roots/fallback" // CA bundle for FROM Scratch
@@ -28,10 +29,16 @@ func main() {
 
 	metrics.Init() // will panic if fails to init.
 
+	sl, err := scrape.FromEnv()
+	if err != nil {
+		log.Error("unable to configure scrapers", slog.Any("error", err))
+		return
+	}
+
 	d, dbCloser := initDB(ctx, log)
 	defer dbCloser()
 
-	j, jCloser := jobber.New(ctx, log, d)
+	j, jCloser := jobber.New(ctx, log, d, jobber.WithScrapeList(sl), jobber.WithDistributedLocks())
 	defer jCloser()
 
 	svr, err := server.New(log, j)
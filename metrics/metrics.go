@@ -3,6 +3,7 @@ package metrics
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -53,6 +54,44 @@ var (
 		[]string{"keywords", "location"},
 	)
 
+	// Labels: "source", "state"
+	JobberCheckedOffers = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jobber_checked_offers",
+			Help: "Total offers checked for being taken down, by resulting state.",
+		},
+		[]string{"source", "state"},
+	)
+
+	// Labels: "scraper", "status"
+	JobberSaveOffers = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "jobber_save_offers_seconds",
+			Help:    "Duration of persisting the offers of a scrape, by scraper and status.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"scraper", "status"},
+	)
+
+	// Labels: "scraper"
+	JobberScrapeJobDelay = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "jobber_scrape_job_delay_seconds",
+			Help:    "Time scrape jobs waited in the queue past their due time, by scraper.",
+			Buckets: []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		},
+		[]string{"scraper"},
+	)
+
+	// Labels: "scraper"
+	JobberCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jobber_circuit_state",
+			Help: "State of the scrapers' circuit breakers: 0 closed, 1 half-open, 2 open.",
+		},
+		[]string{"scraper"},
+	)
+
 	// Labels: "portal", "keywords", "location", itemCount
 	ScraperJob = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -62,6 +101,34 @@ var (
 		},
 		[]string{"portal", "keywords", "location", "itemCount"},
 	)
+
+	// Labels: "host", "limit"
+	ScraperLimiterWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scraper_limiter_wait_seconds",
+			Help:    "Time requests to the job portals waited for their rate or concurrency limit, by host and limit.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host", "limit"},
+	)
+
+	// Labels: "host", "reason"
+	ScraperRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scraper_retries_total",
+			Help: "Total retried requests to the job portals, by host and reason: the status code or network.",
+		},
+		[]string{"host", "reason"},
+	)
+
+	// Labels: "proxy", "reason"
+	ScraperProxyUnhealthy = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scraper_proxy_unhealthy_total",
+			Help: "Total times a proxy was left aside, by proxy and reason: the status code or error.",
+		},
+		[]string{"proxy", "reason"},
+	)
 )
 
 func Init() {
@@ -71,7 +138,14 @@ func Init() {
 		httpRequestsInFlight,
 		JobberScheduledQueries,
 		JobberNewQueries,
+		JobberCheckedOffers,
+		JobberSaveOffers,
+		JobberScrapeJobDelay,
+		JobberCircuitState,
 		ScraperJob,
+		ScraperLimiterWait,
+		ScraperRetries,
+		ScraperProxyUnhealthy,
 	)
 }
 
@@ -81,8 +155,9 @@ func HTTPMiddleware(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		httpRequestsInFlight.WithLabelValues(r.URL.Path).Inc()
-		defer httpRequestsInFlight.WithLabelValues(r.URL.Path).Dec()
+		path := pathLabel(r.URL.Path)
+		httpRequestsInFlight.WithLabelValues(path).Inc()
+		defer httpRequestsInFlight.WithLabelValues(path).Dec()
 		start := time.Now()
 		rec := &statusRecorder{ResponseWriter: w, code: 0}
 		next.ServeHTTP(rec, r)
@@ -91,11 +166,20 @@ func HTTPMiddleware(next http.Handler) http.Handler {
 		if code == 0 {
 			code = http.StatusOK
 		}
-		httpRequests.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(code)).Observe(d)
-		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(code)).Inc()
+		httpRequests.WithLabelValues(r.Method, path, strconv.Itoa(code)).Observe(d)
+		httpRequestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(code)).Inc()
 	})
 }
 
+// pathLabel groups the feed paths under a single label
+// so every feed id doesn't create its own time series.
+func pathLabel(p string) string {
+	if strings.HasPrefix(p, "/f/") {
+		return "/f/{id}"
+	}
+	return p
+}
+
 type statusRecorder struct {
 	http.ResponseWriter
 	code int
@@ -116,3 +200,18 @@ func (r *statusRecorder) Write(b []byte) (int, error) {
 	}
 	return r.ResponseWriter.Write(b)
 }
+
+// Flush lets handlers streaming their responses flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
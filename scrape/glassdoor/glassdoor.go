@@ -7,14 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape/liveness"
 	"github.com/alwedo/jobber/scrape/retryhttp"
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -22,12 +25,15 @@ import (
 const (
 	Name = "Glassdoor"
 
-	baseURL                       = "https://www.glassdoor.de"
+	defaultBaseURL                = "https://www.glassdoor.de"
+	landingEndpoint               = "/Job/index.htm"
 	locationEndpoint              = "/autocomplete/location"
 	searchEndpoint                = "/job-search-next/bff/jobSearchResultsQuery"
 	paramLocationTypeFilters      = "locationTypeFilters"
 	paramLocationTypeFiltersValue = "CITY,STATE,COUNTRY"
 	paramTerm                     = "term" // Term is the location, ie. 'term=berlin'
+
+	maxLandingSize = 4 << 20 // How much of the landing page is searched for the CSRF token.
 )
 
 // When querying the location on the searchEndpoint, glassdoor respond with a
@@ -40,6 +46,10 @@ var locationMap = map[string]string{
 
 var ErrInvalidLocation = errors.New("invalid location")
 
+// csrfToken finds the token the search endpoint expects
+// in the gd-csrf-token header within the landing page.
+var csrfToken = regexp.MustCompile(`"token":\s*"([^"]+)"`)
+
 type location struct {
 	LocationID   int    `json:"locationId"`
 	LocationType string `json:"locationType"`
@@ -90,77 +100,158 @@ type requestBody struct {
 	PageNumber    int    `json:"pageNumber"`
 }
 
+// goneRules describe how Glassdoor shows the offers that were taken down.
+// Expired offers redirect to the search or keep their page with a notice.
+var goneRules = &liveness.Rules{
+	Status:     []int{http.StatusNotFound, http.StatusGone},
+	PathPrefix: "/job-listing/",
+	Markers: []string{
+		"This job is no longer available",
+		"Dieser Job ist nicht mehr verfügbar",
+	},
+}
+
 type glassdoor struct {
-	client *retryhttp.Client
-	lCache sync.Map
+	client     *retryhttp.Client
+	lCache     sync.Map
+	baseURL    string
+	clientOpts []retryhttp.Option
+}
+
+// Option configures the Glassdoor scraper.
+type Option func(*glassdoor)
+
+// WithBaseURL points the scraper to another host than
+// www.glassdoor.de, ie. a local stand-in in tests.
+func WithBaseURL(u string) Option {
+	return func(g *glassdoor) {
+		g.baseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithClientOptions adds options to the scraper's client, applied after
+// its own ones, ie. to record its requests with retryhttp.WithCassette.
+func WithClientOptions(opts ...retryhttp.Option) Option {
+	return func(g *glassdoor) {
+		g.clientOpts = append(g.clientOpts, opts...)
+	}
 }
 
-func New() *glassdoor { //nolint: revive
-	return &glassdoor{
-		client: retryhttp.New(
-			retryhttp.WithRandomUserAgent(),
-
-			// Glassdoor cloudflare some times responds
-			// with 403 and can work after retrying.
-			retryhttp.WithExtraRetryableStatus([]int{
-				http.StatusForbidden,
-			}),
-		),
-		lCache: sync.Map{},
+func New(opts ...Option) *glassdoor { //nolint: revive
+	g := &glassdoor{baseURL: defaultBaseURL, lCache: sync.Map{}}
+	for _, o := range opts {
+		o(g)
 	}
+	g.client = retryhttp.New(append([]retryhttp.Option{
+		retryhttp.WithRandomUserAgent(),
+		retryhttp.WithFullJitter(),
+
+		// Glassdoor cloudflare responds with 403 to requests without
+		// a session, or when it expires. The session is warmed up
+		// again on 403, so the retry gets a fresh one.
+		retryhttp.WithSession(g.warmUp),
+		retryhttp.WithExtraRetryableStatus([]int{
+			http.StatusForbidden,
+		}),
+
+		// Cloudflare gets suspicious of anything faster.
+		retryhttp.WithRateLimit(0.5, 2),
+		retryhttp.WithMaxConcurrency(2),
+	}, g.clientOpts...)...)
+	return g
 }
 
-func (g *glassdoor) Scrape(ctx context.Context, query *db.GetQueryScraperRow) ([]db.CreateOfferParams, error) {
-	offers := []db.CreateOfferParams{}
+// warmUp visits the landing page like a browser would, getting the
+// cookies cloudflare checks and the CSRF token of the search endpoint.
+func (g *glassdoor) warmUp(ctx context.Context, do func(*http.Request) (*http.Response, error)) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+landingEndpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create http request in glassdoor.warmUp: %w", err)
+	}
+	req.Header.Set("Accept", "text/html")
 
-	body, err := g.newRequestBody(ctx, query)
+	resp, err := do(req)
 	if err != nil {
-		if errors.Is(err, ErrInvalidLocation) {
-			// If we find an invalid location we just skip Glassdoor altogether.
-			return nil, nil
-		}
-		return nil, fmt.Errorf("unable to create newRequestBody in glassdoor.Scrape: %w", err)
+		return nil, fmt.Errorf("unable to perform http request in glassdoor.warmUp: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response code %d in glassdoor.warmUp", resp.StatusCode)
 	}
 
-scrape:
-	for nextPage := 2; ; nextPage++ {
-		resp, err := g.fetchOffers(ctx, body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLandingSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the response body in glassdoor.warmUp: %w", err)
+	}
+	header := http.Header{}
+	if m := csrfToken.FindSubmatch(body); m != nil {
+		header.Set("gd-csrf-token", string(m[1]))
+	}
+	return header, nil
+}
+
+// IsGone tells whether the offer was taken down from Glassdoor.
+func (g *glassdoor) IsGone(ctx context.Context, offerURL string) (bool, error) {
+	return liveness.Check(ctx, g.client, offerURL, goneRules)
+}
+
+// Scrape runs a glassdoor search based on a query, yielding the
+// offers of every results page while there's a cursor for the next one.
+func (g *glassdoor) Scrape(ctx context.Context, query *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error] {
+	return func(yield func([]db.CreateOfferParams, error) bool) {
+		body, err := g.newRequestBody(ctx, query)
 		if err != nil {
-			// If fetchOffers fails we return the accumulated offers so far and the error.
-			return offers, fmt.Errorf("failed to fetchOffers in glassdoor.Scrape: %w", err)
+			if errors.Is(err, ErrInvalidLocation) {
+				// If we find an invalid location we just skip Glassdoor altogether.
+				return
+			}
+			yield(nil, fmt.Errorf("unable to create newRequestBody in glassdoor.Scrape: %w", err))
+			return
 		}
 
-		for _, o := range resp.Data.JobListings.JobListings {
-			offers = append(offers, db.CreateOfferParams{
-				// Glassdoor returns only an ageInDays value for when the offer
-				// was published. We use time.Now for our timestamps and substract
-				// the amount of days from ageInDays when it's not 0.
-				PostedAt: pgtype.Timestamptz{
-					Time:  time.Now().AddDate(0, 0, -o.JobView.Header.AgeInDays),
-					Valid: true,
-				},
-				ID:          strconv.Itoa(o.JobView.Job.ListingID),
-				Title:       o.JobView.Job.JobTitleText,
-				Company:     o.JobView.Header.EmployerNameFromSearch,
-				Location:    o.JobView.Header.LocationName,
-				Description: strings.Join(o.JobView.Job.DescriptionFragmentsText, " "),
-				Source:      Name,
-				Url:         o.JobView.Header.SEOJobLink,
-			})
-		}
+	scrape:
+		for nextPage := 2; ; nextPage++ {
+			resp, err := g.fetchOffers(ctx, body)
+			if err != nil {
+				// The pages yielded so far have already been handled.
+				yield(nil, fmt.Errorf("failed to fetchOffers in glassdoor.Scrape: %w", err))
+				return
+			}
 
-		// Check for the next page in paginationCursors
-		for _, pagCur := range resp.Data.JobListings.PaginationCursors {
-			if pagCur.PageNumber == nextPage {
-				body.PageCursor = pagCur.Cursor
-				body.PageNumber = pagCur.PageNumber
-				continue scrape
+			offers := make([]db.CreateOfferParams, 0, len(resp.Data.JobListings.JobListings))
+			for _, o := range resp.Data.JobListings.JobListings {
+				offers = append(offers, db.CreateOfferParams{
+					// Glassdoor returns only an ageInDays value for when the offer
+					// was published. We use time.Now for our timestamps and substract
+					// the amount of days from ageInDays when it's not 0.
+					PostedAt: pgtype.Timestamptz{
+						Time:  time.Now().AddDate(0, 0, -o.JobView.Header.AgeInDays),
+						Valid: true,
+					},
+					ExternalID:  strconv.Itoa(o.JobView.Job.ListingID),
+					Title:       o.JobView.Job.JobTitleText,
+					Company:     o.JobView.Header.EmployerNameFromSearch,
+					Location:    o.JobView.Header.LocationName,
+					Description: strings.Join(o.JobView.Job.DescriptionFragmentsText, " "),
+					Source:      Name,
+					Url:         o.JobView.Header.SEOJobLink,
+				})
 			}
+			if !yield(offers, nil) {
+				return
+			}
+
+			// Check for the next page in paginationCursors
+			for _, pagCur := range resp.Data.JobListings.PaginationCursors {
+				if pagCur.PageNumber == nextPage {
+					body.PageCursor = pagCur.Cursor
+					body.PageNumber = pagCur.PageNumber
+					continue scrape
+				}
+			}
+			return
 		}
-		break
 	}
-
-	return offers, nil
 }
 
 func (g *glassdoor) fetchOffers(ctx context.Context, rb *requestBody) (*response, error) {
@@ -169,7 +260,7 @@ func (g *glassdoor) fetchOffers(ctx context.Context, rb *requestBody) (*response
 		return nil, fmt.Errorf("unable to marshal body in glassdoor.fetchOffers: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+searchEndpoint, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+searchEndpoint, bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create http request in glassdoor.fetchOffers: %w", err)
 	}
@@ -177,10 +268,12 @@ func (g *glassdoor) fetchOffers(ctx context.Context, rb *requestBody) (*response
 	req.Header.Set("Accept", "*/*")
 
 	resp, err := g.client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to perform http request in glassdor.fetchOffers: %w", err)
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -244,9 +337,9 @@ func (g *glassdoor) fetchLocation(ctx context.Context, loc string) (*location, e
 	params.Add(paramLocationTypeFilters, paramLocationTypeFiltersValue)
 	params.Add(paramTerm, loc)
 
-	u, err := url.Parse(baseURL + locationEndpoint)
+	u, err := url.Parse(g.baseURL + locationEndpoint)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse url %s in glassdoor.fetchLocation: %w", baseURL+locationEndpoint, err)
+		return nil, fmt.Errorf("unable to parse url %s in glassdoor.fetchLocation: %w", g.baseURL+locationEndpoint, err)
 	}
 	u.RawQuery = params.Encode()
 
@@ -258,10 +351,12 @@ func (g *glassdoor) fetchLocation(ctx context.Context, loc string) (*location, e
 	req.Header.Set("Accept", "*/*")
 
 	resp, err := g.client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to perform http request glassdoor.fetchLocation: %w", err)
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -6,9 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
-	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -17,9 +18,13 @@ import (
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/alwedo/jobber/scrape/scrapetest"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// cassette has the responses of a search for golang jobs in berlin.
+const cassette = "test_data/cassette.json"
+
 func TestScrape(t *testing.T) {
 	t.Run("paginated response", func(t *testing.T) {
 		synctest.Test(t, func(*testing.T) {
@@ -29,22 +34,24 @@ func TestScrape(t *testing.T) {
 					retryhttp.WithTransport(mock),
 					retryhttp.WithRandomUserAgent(),
 				),
-				lCache: sync.Map{},
+				lCache:  sync.Map{},
+				baseURL: defaultBaseURL,
 			}
-			result, err := g.Scrape(context.Background(), &db.GetQueryScraperRow{
+			pages, err := scrapePages(g.Scrape(context.Background(), &db.GetQueryScraperRow{
 				Keywords: "developer",
 				Location: "germany",
-			})
+			}))
 			if err != nil {
 				t.Errorf("scraper failed: %v", err)
 			}
+			result := slices.Concat(pages...)
 
 			if len(result) != 83 {
 				t.Fatalf("wanted 83 offers, got %d", len(result))
 			}
 
 			wantFirstResult := db.CreateOfferParams{
-				ID:          "1010007206002",
+				ExternalID:  "1010007206002",
 				Title:       "Lead Backend Engineer | PHP Symfony",
 				Company:     "Dyflexis",
 				Location:    "Köln",
@@ -58,10 +65,10 @@ func TestScrape(t *testing.T) {
 			}
 
 			wantLastResult := db.CreateOfferParams{
-				ID:       "1010007519935",
-				Title:    "Senior Cloud Solution Developer (m/w/d)",
-				Company:  "Sopra Steria",
-				Location: "Deutschland",
+				ExternalID: "1010007519935",
+				Title:      "Senior Cloud Solution Developer (m/w/d)",
+				Company:    "Sopra Steria",
+				Location:   "Deutschland",
 				// The last job offer as an `ageInDays` of 1, so  we expect the PostedAt date to be now - 1 day.
 				PostedAt:    pgtype.Timestamptz{Time: time.Now().AddDate(0, 0, -1), Valid: true},
 				Description: "Wir sind als eine der führenden europäischen Management- und Technologieberatungen ein echter Tech-Player. Wir sehen uns als Vordenker*innen, handeln und denken…",
@@ -81,21 +88,51 @@ func TestScrape(t *testing.T) {
 				retryhttp.WithTransport(mock),
 				retryhttp.WithRandomUserAgent(),
 			),
-			lCache: sync.Map{},
+			lCache:  sync.Map{},
+			baseURL: defaultBaseURL,
 		}
-		result, err := g.Scrape(context.Background(), &db.GetQueryScraperRow{
+		pages, err := scrapePages(g.Scrape(context.Background(), &db.GetQueryScraperRow{
 			Keywords: "developer",
 			Location: "invalid",
-		})
+		}))
 		if err != nil {
 			t.Errorf("expected err to be nil, got: %v", err)
 		}
-		if result != nil {
-			t.Errorf("expected result to be nil, got: %v", result)
+		if pages != nil {
+			t.Errorf("expected no pages, got: %v", pages)
 		}
 	})
 }
 
+// TestScrapeCassette replays a search recorded from the job portal.
+// Run `make cassettes` to record it again after the portal changes.
+// It's still made of the former test responses, with a made up landing
+// page instead of a real session.
+func TestScrapeCassette(t *testing.T) {
+	scrapetest.Replay(t, cassette, func(o ...retryhttp.Option) scrapetest.Scraper {
+		return New(WithClientOptions(o...))
+	}, &db.GetQueryScraperRow{Keywords: "golang", Location: "berlin"}, scrapetest.Want{
+		Source:  Name,
+		Pages:   3,
+		Offers:  83,
+		FirstID: "1010007206002",
+		LastID:  "1010007519935",
+	})
+}
+
+// scrapePages runs the scraper's search and returns the offers of every
+// page it yielded, along with the error that ended it, if any.
+func scrapePages(seq iter.Seq2[[]db.CreateOfferParams, error]) ([][]db.CreateOfferParams, error) {
+	var pages [][]db.CreateOfferParams
+	for offers, err := range seq {
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, offers)
+	}
+	return pages, nil
+}
+
 func TestFetchOffers(t *testing.T) {
 	mock := newGlassdoorMock(t)
 	g := &glassdoor{
@@ -103,7 +140,8 @@ func TestFetchOffers(t *testing.T) {
 			retryhttp.WithTransport(mock),
 			retryhttp.WithRandomUserAgent(),
 		),
-		lCache: sync.Map{},
+		lCache:  sync.Map{},
+		baseURL: defaultBaseURL,
 	}
 
 	query := &db.GetQueryScraperRow{
@@ -130,8 +168,8 @@ func TestFetchOffers(t *testing.T) {
 	}
 
 	gotURL := mock.req.URL.Scheme + "://" + mock.req.URL.Host
-	if gotURL != baseURL {
-		t.Errorf("wanted url %s, got %s", baseURL, gotURL)
+	if gotURL != defaultBaseURL {
+		t.Errorf("wanted url %s, got %s", defaultBaseURL, gotURL)
 	}
 
 	if mock.req.URL.Path != searchEndpoint {
@@ -194,7 +232,8 @@ func TestNewRequestBody(t *testing.T) {
 			retryhttp.WithTransport(mock),
 			retryhttp.WithRandomUserAgent(),
 		),
-		lCache: sync.Map{},
+		lCache:  sync.Map{},
+		baseURL: defaultBaseURL,
 	}
 
 	tests := []struct {
@@ -258,6 +297,11 @@ func TestFetchLocation(t *testing.T) {
 			location:     "berlin",
 			wantHTTPCall: true,
 		},
+		{
+			name:         "it encodes unicode and punctuation in the autocomplete term",
+			location:     "saint-étienne-du-rouvray",
+			wantHTTPCall: true,
+		},
 		{
 			name:     "it doesn't call glassdoor if location is cached",
 			location: "berlin",
@@ -294,7 +338,8 @@ func TestFetchLocation(t *testing.T) {
 					retryhttp.WithTransport(mock),
 					retryhttp.WithRandomUserAgent(),
 				),
-				lCache: sync.Map{},
+				lCache:  sync.Map{},
+				baseURL: defaultBaseURL,
 			}
 			if tt.gd != nil {
 				tt.gd(g)
@@ -314,8 +359,8 @@ func TestFetchLocation(t *testing.T) {
 
 			if tt.wantHTTPCall {
 				gotURL := mock.req.URL.Scheme + "://" + mock.req.URL.Host
-				if gotURL != baseURL {
-					t.Errorf("wanted url %s, got %s", baseURL, gotURL)
+				if gotURL != defaultBaseURL {
+					t.Errorf("wanted url %s, got %s", defaultBaseURL, gotURL)
 				}
 
 				if mock.req.URL.Path != locationEndpoint {
@@ -375,16 +420,63 @@ func TestFetchLocation(t *testing.T) {
 	}
 }
 
+func TestSession(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		mock := newGlassdoorMock(t)
+		mock.forbidden = 1
+		g := &glassdoor{
+			lCache:  sync.Map{},
+			baseURL: defaultBaseURL,
+		}
+		g.client = retryhttp.New(
+			retryhttp.WithTransport(mock),
+			retryhttp.WithSession(g.warmUp),
+			retryhttp.WithExtraRetryableStatus([]int{http.StatusForbidden}),
+		)
+
+		_, err := scrapePages(g.Scrape(context.Background(), &db.GetQueryScraperRow{
+			Keywords: "developer",
+			Location: "germany",
+		}))
+		if err != nil {
+			t.Fatalf("scraper failed: %v", err)
+		}
+
+		// The session is warmed up for the first request
+		// and again after the 403, then reused for every page.
+		if mock.landings != 2 {
+			t.Errorf("wanted the landing page to be visited twice, got %d", mock.landings)
+		}
+		if got := mock.req.Header.Get("gd-csrf-token"); got != "cuak-2" {
+			t.Errorf("wanted the CSRF token of the second session, got %q", got)
+		}
+		if c, err := mock.req.Cookie("GSESSIONID"); err != nil || c.Value != "session-2" {
+			t.Errorf("wanted the cookie of the second session, got %v", c)
+		}
+	})
+}
+
 type glassdoorMock struct {
 	t       testing.TB
 	req     *http.Request
 	reqBody *requestBody
+
+	// landings counts the visits to the landing page, and forbidden
+	// is how many searches are answered with 403 before serving them.
+	landings  int
+	forbidden int
+
+	// locations and pages are the cassette's responses.
+	locations []string
+	pages     []string
 }
 
 func newGlassdoorMock(t testing.TB) *glassdoorMock {
 	return &glassdoorMock{
-		t:       t,
-		reqBody: &requestBody{},
+		t:         t,
+		reqBody:   &requestBody{},
+		locations: scrapetest.Responses(t, cassette, locationEndpoint),
+		pages:     scrapetest.Responses(t, cassette, searchEndpoint),
 	}
 }
 
@@ -396,32 +488,37 @@ func (g *glassdoorMock) RoundTrip(req *http.Request) (*http.Response, error) {
 		StatusCode: http.StatusOK,
 	}
 
-	var fn string
 	switch req.URL.Path {
+	case landingEndpoint:
+		g.landings++
+		resp.Header = http.Header{}
+		resp.Header.Set("Set-Cookie", fmt.Sprintf("GSESSIONID=session-%d; Path=/", g.landings))
+		resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(`<script>window.gdCfg = {"token": "cuak-%d"}</script>`, g.landings)))
 	case locationEndpoint:
 		if req.URL.Query().Get(paramTerm) == "invalid" {
 			resp.Body = io.NopCloser(strings.NewReader("[]"))
 		} else {
-			fn = "test_data/location.json"
+			resp.Body = io.NopCloser(strings.NewReader(g.locations[0]))
 		}
 	case searchEndpoint:
 		defer req.Body.Close()
+		if g.forbidden > 0 {
+			g.forbidden--
+			resp.StatusCode = http.StatusForbidden
+			resp.Body = io.NopCloser(strings.NewReader("blocked"))
+			return resp, nil
+		}
 
 		// Decode reqBody into mock for further inspection
 		if err := json.NewDecoder(req.Body).Decode(g.reqBody); err != nil {
 			g.t.Fatalf("unable to decode request body in glassdoorMock: %v", err)
 		}
 
-		fn = fmt.Sprintf("test_data/glassdoor%d.json", g.reqBody.PageNumber)
-	}
-
-	if fn != "" {
-		body, err := os.Open(fn)
-		if err != nil {
-			g.t.Fatalf("failed to open %s in mockResp.RoundTrip: %s", fn, err)
-			return resp, err
+		page := g.reqBody.PageNumber
+		if page < 1 || page > len(g.pages) {
+			g.t.Fatalf("unexpected page %d in glassdoorMock", page)
 		}
-		resp.Body = body
+		resp.Body = io.NopCloser(strings.NewReader(g.pages[page-1]))
 	}
 
 	return resp, nil
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/metrics"
+	"github.com/alwedo/jobber/scrape/liveness"
 	"github.com/alwedo/jobber/scrape/retryhttp"
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -20,64 +22,116 @@ import (
 const (
 	Name = "LinkedIn"
 
-	linkedInURL      = "https://www.linkedin.com/jobs-guest/jobs/api/seeMoreJobPostings/search"
-	linkedInBaseURL  = "https://www.linkedin.com/jobs/view/" // Direct link to job posting
-	paramKeywords    = "keywords"                            // Search keywords, ie. "golang"
-	paramLocation    = "location"                            // Location of the search, ie. "Berlin"
-	paramStart       = "start"                               // Start of the pagination, in intervals of 10s, ie. "10"
-	paramFTPR        = "f_TPR"                               // Time Posted Range. Values are in seconds, starting with 'r', ie. r86400 = Past 24 hours
-	searchInterval   = 10                                    // LinkedIn pagination interval
-	maxSearchInt     = 1000                                  // LinkedIn's site returns StatusBadRequest if 'start=1000'
+	defaultBaseURL   = "https://www.linkedin.com"
+	searchEndpoint   = "/jobs-guest/jobs/api/seeMoreJobPostings/search"
+	viewEndpoint     = "/jobs/view/" // Direct link to job posting
+	paramKeywords    = "keywords"    // Search keywords, ie. "golang"
+	paramLocation    = "location"    // Location of the search, ie. "Berlin"
+	paramStart       = "start"       // Start of the pagination, in intervals of 10s, ie. "10"
+	paramFTPR        = "f_TPR"       // Time Posted Range. Values are in seconds, starting with 'r', ie. r86400 = Past 24 hours
+	searchInterval   = 10            // LinkedIn pagination interval
+	maxSearchInt     = 1000          // LinkedIn's site returns StatusBadRequest if 'start=1000'
 	oneWeekInSeconds = 604800
 )
 
+// goneRules describe how LinkedIn shows the offers that were taken down.
+// Closed offers keep their page with a notice, removed ones redirect to the search.
+var goneRules = &liveness.Rules{
+	Status:     []int{http.StatusNotFound, http.StatusGone},
+	PathPrefix: viewEndpoint,
+	Markers:    []string{"No longer accepting applications"},
+}
+
 type linkedIn struct {
-	client *retryhttp.Client
+	client     *retryhttp.Client
+	baseURL    string
+	clientOpts []retryhttp.Option
+}
+
+// Option configures the LinkedIn scraper.
+type Option func(*linkedIn)
+
+// WithBaseURL points the scraper to another host than
+// www.linkedin.com, ie. a local stand-in in tests.
+func WithBaseURL(u string) Option {
+	return func(l *linkedIn) {
+		l.baseURL = strings.TrimSuffix(u, "/")
+	}
 }
 
-func New() *linkedIn { //nolint: revive
-	return &linkedIn{client: retryhttp.New()}
+// WithClientOptions adds options to the scraper's client, applied after
+// its own ones, ie. to record its requests with retryhttp.WithCassette.
+func WithClientOptions(opts ...retryhttp.Option) Option {
+	return func(l *linkedIn) {
+		l.clientOpts = append(l.clientOpts, opts...)
+	}
 }
 
-// search runs a linkedin search based on a query.
+func New(opts ...Option) *linkedIn { //nolint: revive
+	l := &linkedIn{baseURL: defaultBaseURL}
+	for _, o := range opts {
+		o(l)
+	}
+	l.client = retryhttp.New(append([]retryhttp.Option{
+		retryhttp.WithFullJitter(),
+
+		// LinkedIn answers with 429 as soon as it sees a few
+		// requests in a row, so we keep well below that.
+		retryhttp.WithRateLimit(1, 3),
+		retryhttp.WithMaxConcurrency(2),
+	}, l.clientOpts...)...)
+	return l
+}
+
+// Scrape runs a linkedin search based on a query.
 // It will paginate over the search results until it doesn't find any more offers,
-// Scrape the data and return a slice of offers ready to be added to the DB.
-func (l *linkedIn) Scrape(ctx context.Context, query *db.GetQueryScraperRow) ([]db.CreateOfferParams, error) {
-	t := time.Now()
-	var totalOffers []db.CreateOfferParams
-	var offers []db.CreateOfferParams
-
-	for i := 0; i < maxSearchInt; i += searchInterval {
-		select {
-		case <-ctx.Done():
-			return totalOffers, fmt.Errorf("linkedIn.Scrape process was canceled: %w", ctx.Err())
-		default:
+// yielding the offers of every page ready to be added to the DB as it goes.
+func (l *linkedIn) Scrape(ctx context.Context, query *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error] {
+	return func(yield func([]db.CreateOfferParams, error) bool) {
+		t := time.Now()
+		var totalOffers int
+
+		for i := 0; i < maxSearchInt; i += searchInterval {
+			select {
+			case <-ctx.Done():
+				yield(nil, fmt.Errorf("linkedIn.Scrape process was canceled: %w", ctx.Err()))
+				return
+			default:
+			}
+			// If fetching or parsing a page fails the pages
+			// yielded so far have already been handled.
 			resp, err := l.fetchOffersPage(ctx, query, i)
 			if err != nil {
-				// If fetchOffersPage fails we return the accumulated offers so far.
-				return totalOffers, fmt.Errorf("failed to fetchOffersPage in linkedIn.Scrape: %w", err)
+				yield(nil, fmt.Errorf("failed to fetchOffersPage in linkedIn.Scrape: %w", err))
+				return
 			}
-			offers, err = l.parseLinkedInBody(resp)
+			offers, err := l.parseLinkedInBody(resp)
 			if err != nil {
-				// If parseLinkedInBody fails we return the accumulated offers so far.
-				return totalOffers, fmt.Errorf("failed to parseLinkedInBody body linkedIn.Scrape: %w", err)
+				yield(nil, fmt.Errorf("failed to parseLinkedInBody body linkedIn.Scrape: %w", err))
+				return
+			}
+			totalOffers += len(offers)
+			if !yield(offers, nil) {
+				return
+			}
+			// LinkedIn returns batches of 10 offers. If a batch has 10
+			// offers we assume there is a next page, otherwise we stop.
+			if len(offers) != searchInterval {
+				break
 			}
-			totalOffers = append(totalOffers, offers...)
-		}
-		// LinkedIn returns batches of 10 offers. If a batch has 10
-		// offers we assume there is a next page, otherwise we stop.
-		if len(offers) != searchInterval {
-			break
 		}
+		metrics.ScraperJob.WithLabelValues(
+			Name,
+			query.Keywords,
+			query.Location,
+			strconv.Itoa(totalOffers),
+		).Observe(time.Since(t).Seconds())
 	}
-	metrics.ScraperJob.WithLabelValues(
-		Name,
-		query.Keywords,
-		query.Location,
-		strconv.Itoa(len(totalOffers)),
-	).Observe(time.Since(t).Seconds())
-
-	return totalOffers, nil
+}
+
+// IsGone tells whether the offer was taken down from LinkedIn.
+func (l *linkedIn) IsGone(ctx context.Context, offerURL string) (bool, error) {
+	return liveness.Check(ctx, l.client, offerURL, goneRules)
 }
 
 // fetchOffersPage gets job offers from LinkedIn based on the passed query params.
@@ -99,7 +153,7 @@ func (l *linkedIn) fetchOffersPage(ctx context.Context, query *db.GetQueryScrape
 	}
 	qp.Add(paramFTPR, fmt.Sprintf("r%d", ftpr))
 
-	url, err := url.Parse(linkedInURL)
+	url, err := url.Parse(l.baseURL + searchEndpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse URL in linkedin.fetchOffersPage: %w", err)
 	}
@@ -112,6 +166,9 @@ func (l *linkedIn) fetchOffersPage(ctx context.Context, query *db.GetQueryScrape
 
 	resp, err := l.client.Do(req)
 	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
 		return nil, fmt.Errorf("failed to do http request in linkedin.fetchOffersPage: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
@@ -145,11 +202,11 @@ func (l *linkedIn) parseLinkedInBody(body io.ReadCloser) ([]db.CreateOfferParams
 			// Extract Job ID from data-entity-urn
 			if urn, exists := s.Find("[data-entity-urn]").Attr("data-entity-urn"); exists {
 				id := strings.Split(urn, ":")
-				job.ID = id[len(id)-1]
+				job.ExternalID = id[len(id)-1]
 			}
 
 			// Construct direct link to job posting
-			job.Url = linkedInBaseURL + job.ID
+			job.Url = l.baseURL + viewEndpoint + job.ExternalID
 
 			// Extract Title
 			job.Title = normalizeText(s.Find(".base-search-card__title").Text())
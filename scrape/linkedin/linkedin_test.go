@@ -5,21 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"iter"
 	"net/http"
-	"os"
+	"slices"
+	"strings"
 	"testing"
 	"testing/synctest"
 	"time"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/alwedo/jobber/scrape/scrapetest"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// cassette has the responses of a search for golang jobs in berlin.
+const cassette = "test_data/cassette.json"
+
 func TestFetchOffersPage(t *testing.T) {
 	mockResp := newLinkedInMockResp(t)
-	l := &linkedIn{retryhttp.New(retryhttp.WithTransport(mockResp))}
+	l := &linkedIn{client: retryhttp.New(retryhttp.WithTransport(mockResp)), baseURL: defaultBaseURL}
 	ctx := context.Background()
 
 	t.Run("first time query", func(t *testing.T) {
@@ -48,15 +53,7 @@ func TestFetchOffersPage(t *testing.T) {
 		if mockResp.req.URL.Path != "/jobs-guest/jobs/api/seeMoreJobPostings/search" {
 			t.Errorf("expected path to be '/jobs-guest/jobs/api/seeMoreJobPostings/search', got %s", mockResp.req.URL.Path)
 		}
-		file, err := os.Open("test_data/linkedin1.html")
-		if err != nil {
-			t.Fatalf("failed to open file test_data/linkedin1.html: %s", err.Error())
-		}
-		defer file.Close()
-		want, err := io.ReadAll(file)
-		if err != nil {
-			t.Fatalf("failed to read example1.html file: %s", err.Error())
-		}
+		want := scrapetest.Responses(t, cassette, searchEndpoint)[0]
 		got, err := io.ReadAll(resp)
 		if err != nil {
 			t.Errorf("unable to read response body: %v", err)
@@ -66,6 +63,25 @@ func TestFetchOffersPage(t *testing.T) {
 		}
 	})
 
+	t.Run("unicode and punctuation are encoded as query params", func(t *testing.T) {
+		query := &db.GetQueryScraperRow{
+			Keywords: "c++ c# .net",
+			Location: "düsseldorf",
+		}
+		resp, err := l.fetchOffersPage(ctx, query, 0)
+		if err != nil {
+			t.Fatalf("error fetching offers: %s", err.Error())
+		}
+		defer resp.Close()
+		values := mockResp.req.URL.Query()
+		if values.Get(paramKeywords) != query.Keywords {
+			t.Errorf("expected 'keywords' in query params to be '%s', got %s", query.Keywords, values.Get(paramKeywords))
+		}
+		if values.Get(paramLocation) != query.Location {
+			t.Errorf("expected 'location' in query params to be '%s', got %s", query.Location, values.Get(paramLocation))
+		}
+	})
+
 	t.Run("queries with UpdatedAt field should have relative FTPR", func(t *testing.T) {
 		query := &db.GetQueryScraperRow{
 			Keywords:  "golang",
@@ -138,23 +154,18 @@ func TestFetchOffersPage(t *testing.T) {
 }
 
 func TestParseLinkedInBody(t *testing.T) {
-	l := &linkedIn{}
-
-	file, err := os.Open("test_data/linkedin1.html")
-	if err != nil {
-		log.Fatalf("failed to open file: %s", err.Error())
-	}
-	defer file.Close()
+	l := &linkedIn{baseURL: defaultBaseURL}
 
-	jobs, err := l.parseLinkedInBody(file)
+	page := scrapetest.Responses(t, cassette, searchEndpoint)[0]
+	jobs, err := l.parseLinkedInBody(io.NopCloser(strings.NewReader(page)))
 	if err != nil {
-		t.Fatalf("error parsing test_data/linkedin1.html: %s", err.Error())
+		t.Fatalf("error parsing the first page of the cassette: %s", err.Error())
 	}
 	if len(jobs) != 10 {
 		t.Errorf("expected 10 jobs, got %d", len(jobs))
 	}
-	if jobs[0].ID != "4322119156" {
-		t.Errorf("expected job ID 4322119156, got %s", jobs[0].ID)
+	if jobs[0].ExternalID != "4322119156" {
+		t.Errorf("expected job ID 4322119156, got %s", jobs[0].ExternalID)
 	}
 	if jobs[0].Url != "https://www.linkedin.com/jobs/view/4322119156" {
 		t.Errorf("expected url to be https://www.linkedin.com/jobs/view/4322119156, got %s", jobs[0].Url)
@@ -181,17 +192,20 @@ func TestParseLinkedInBody(t *testing.T) {
 
 func TestScrape(t *testing.T) {
 	mockResp := newLinkedInMockResp(t)
-	l := &linkedIn{retryhttp.New(retryhttp.WithTransport(mockResp))}
+	l := &linkedIn{client: retryhttp.New(retryhttp.WithTransport(mockResp)), baseURL: defaultBaseURL}
 
 	t.Run("expected behaviour", func(t *testing.T) {
 		synctest.Test(t, func(t *testing.T) {
 			query := &db.GetQueryScraperRow{Keywords: "golang", Location: "the moon"}
-			offers, err := l.Scrape(context.Background(), query)
+			pages, err := scrapePages(l.Scrape(context.Background(), query))
 			if err != nil {
 				t.Errorf("expected no error, got %v", err)
 			}
 			synctest.Wait()
-			if len(offers) != 27 {
+			if len(pages) != 3 {
+				t.Errorf("expected 3 pages, got %d", len(pages))
+			}
+			if offers := slices.Concat(pages...); len(offers) != 27 {
 				t.Errorf("expected 27 offers, got %d", len(offers))
 			}
 		})
@@ -199,18 +213,47 @@ func TestScrape(t *testing.T) {
 	t.Run("too many retries don't discard data", func(t *testing.T) {
 		synctest.Test(t, func(t *testing.T) {
 			query := &db.GetQueryScraperRow{Keywords: "retry-fail", Location: "the moon"}
-			offers, err := l.Scrape(context.Background(), query)
+			pages, err := scrapePages(l.Scrape(context.Background(), query))
 			if !errors.Is(err, retryhttp.ErrRetryable) {
 				t.Errorf("expected ErrRetryable, got: %v", err)
 			}
 			synctest.Wait()
-			if len(offers) != 10 {
-				t.Errorf("expected 10 offers from the first page, got %d", len(offers))
+			if len(pages) != 1 || len(pages[0]) != 10 {
+				t.Errorf("expected the 10 offers of the first page, got %d pages", len(pages))
 			}
 		})
 	})
 }
 
+// TestScrapeCassette replays a search recorded from the job portal.
+// Run `make cassettes` to record it again after the portal changes.
+// Until then it holds LinkedIn's former test pages, which is why
+// its responses have no headers.
+func TestScrapeCassette(t *testing.T) {
+	scrapetest.Replay(t, cassette, func(o ...retryhttp.Option) scrapetest.Scraper {
+		return New(WithClientOptions(o...))
+	}, &db.GetQueryScraperRow{Keywords: "golang", Location: "berlin"}, scrapetest.Want{
+		Source:  Name,
+		Pages:   3,
+		Offers:  27,
+		FirstID: "4322119156",
+		LastID:  "4236717715",
+	})
+}
+
+// scrapePages runs the scraper's search and returns the offers of every
+// page it yielded, along with the error that ended it, if any.
+func scrapePages(seq iter.Seq2[[]db.CreateOfferParams, error]) ([][]db.CreateOfferParams, error) {
+	var pages [][]db.CreateOfferParams
+	for offers, err := range seq {
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, offers)
+	}
+	return pages, nil
+}
+
 func TestNormalizeTime(t *testing.T) {
 	tests := []struct {
 		name, relative, wantTime string
@@ -247,6 +290,7 @@ type linkedInMockResp struct {
 	t       testing.TB
 	req     *http.Request
 	lastReq time.Time
+	pages   []string
 }
 
 func (h *linkedInMockResp) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -271,22 +315,15 @@ func (h *linkedInMockResp) RoundTrip(req *http.Request) (*http.Response, error)
 		status = http.StatusTooManyRequests
 	}
 
-	// Mock LinkedIn pagination strategy
-	fn := "test_data/linkedin1.html"
+	// Mock LinkedIn pagination strategy with the cassette's pages.
+	page := 0
 	switch req.URL.Query().Get("start") {
 	case "10":
-		fn = "test_data/linkedin2.html"
+		page = 1
 	case "20":
-		fn = "test_data/linkedin3.html"
-	}
-
-	// Return the html according to pagination
-	body, err := os.Open(fn)
-	if err != nil {
-		h.t.Fatalf("failed to open %s in mockResp.RoundTrip: %s", fn, err)
-		return resp, err
+		page = 2
 	}
-	resp.Body = body
+	resp.Body = io.NopCloser(strings.NewReader(h.pages[page]))
 	resp.StatusCode = status
 
 	// Save last request time for mocking 429
@@ -296,5 +333,5 @@ func (h *linkedInMockResp) RoundTrip(req *http.Request) (*http.Response, error)
 }
 
 func newLinkedInMockResp(t testing.TB) *linkedInMockResp {
-	return &linkedInMockResp{t: t}
+	return &linkedInMockResp{t: t, pages: scrapetest.Responses(t, cassette, searchEndpoint)}
 }
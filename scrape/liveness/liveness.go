@@ -0,0 +1,76 @@
+// Package liveness tells whether a job offer is still published in its job portal.
+//
+// Every portal shows taken down offers differently, some respond with 404, others
+// redirect to a search page or keep the page with a notice, so each scraper
+// describes its own Rules and checks its offers with its own retryhttp.Client.
+package liveness
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/alwedo/jobber/scrape/retryhttp"
+)
+
+// maxBodySize is how much of the offer page is searched for markers.
+const maxBodySize = 1 << 20
+
+// Rules describe how a job portal shows an offer that was taken down.
+type Rules struct {
+	// Status are the status codes of gone offers, ie. 404 or 410.
+	Status []int
+	// PathPrefix is the path prefix of offer pages. Offers redirecting
+	// somewhere else, ie. to a search page, are gone.
+	PathPrefix string
+	// Markers are texts only found in the page of gone offers.
+	Markers []string
+}
+
+// Check requests the offer's url and tells whether it's gone following the rules.
+// Any other non 2xx response returns an error since it can't tell the offer's state.
+func Check(ctx context.Context, c *retryhttp.Client, offerURL string, r *Rules) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, offerURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request in liveness.Check: %w", err)
+	}
+	// The response of the last try comes along with the error once
+	// retries are exhausted, so it has to be closed as well.
+	resp, err := c.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to do http request in liveness.Check: %w", err)
+	}
+
+	if slices.Contains(r.Status, resp.StatusCode) {
+		return true, nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return false, fmt.Errorf("unexpected response code %d in liveness.Check", resp.StatusCode)
+	}
+	// The client follows redirects, so the request of the
+	// response is the one of the page we ended up in.
+	if r.PathPrefix != "" && !strings.HasPrefix(resp.Request.URL.Path, r.PathPrefix) {
+		return true, nil
+	}
+	if len(r.Markers) == 0 {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return false, fmt.Errorf("failed to read response body in liveness.Check: %w", err)
+	}
+	for _, m := range r.Markers {
+		if bytes.Contains(body, []byte(m)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,104 @@
+package liveness
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alwedo/jobber/scrape/retryhttp"
+)
+
+func TestCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/view/open", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<h1>Golang Dweeb</h1><button>Apply</button>"))
+	})
+	mux.HandleFunc("GET /jobs/view/closed", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<h1>Golang Dweeb</h1><p>No longer accepting applications</p>"))
+	})
+	mux.HandleFunc("GET /jobs/view/removed", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /jobs/view/expired", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/jobs/search?expired=true", http.StatusFound)
+	})
+	mux.HandleFunc("GET /jobs/view/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/jobs/view/open", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("GET /jobs/search", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<h1>Search</h1>"))
+	})
+	mux.HandleFunc("GET /jobs/view/blocked", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rules := &Rules{
+		Status:     []int{http.StatusNotFound, http.StatusGone},
+		PathPrefix: "/jobs/view/",
+		Markers:    []string{"No longer accepting applications"},
+	}
+	c := retryhttp.New()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantGone bool
+		wantErr  bool
+	}{
+		{name: "open offer", path: "/jobs/view/open", wantGone: false},
+		{name: "offer with gone marker", path: "/jobs/view/closed", wantGone: true},
+		{name: "offer with gone status", path: "/jobs/view/removed", wantGone: true},
+		{name: "offer redirecting out of the offer pages", path: "/jobs/view/expired", wantGone: true},
+		{name: "offer redirecting to another offer page", path: "/jobs/view/moved", wantGone: false},
+		{name: "blocked request", path: "/jobs/view/blocked", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gone, err := Check(context.Background(), c, server.URL+tt.path, rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %t, got %v", tt.wantErr, err)
+			}
+			if gone != tt.wantGone {
+				t.Errorf("wanted gone to be %t, got %t", tt.wantGone, gone)
+			}
+		})
+	}
+
+	t.Run("exhausted retries close the response", func(t *testing.T) {
+		var closed bool
+		c := retryhttp.New(
+			retryhttp.WithMaxAttempts(1),
+			retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+				body := &closeRecorder{ReadCloser: http.NoBody, closed: &closed}
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: body}, nil
+			})),
+		)
+		if _, err := Check(context.Background(), c, server.URL+"/jobs/view/open", rules); !errors.Is(err, retryhttp.ErrRetryable) {
+			t.Fatalf("wanted ErrRetryable, got %v", err)
+		}
+		if !closed {
+			t.Error("wanted the response body to be closed")
+		}
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// closeRecorder records whether the body was closed.
+type closeRecorder struct {
+	io.ReadCloser
+	closed *bool
+}
+
+func (c *closeRecorder) Close() error {
+	*c.closed = true
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,229 @@
+package retryhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// randomID matches the uuids scrapers make up for every request, ie. Stepstone's
+// userHashId, which are left out of the body hash so the requests still match.
+var randomID = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// sessionHeaders are left out of the recorded responses so the cassettes
+// don't keep the portals' cookies or ids of our sessions.
+var sessionHeaders = []string{"Set-Cookie", "Cf-Ray", "X-Request-Id"}
+
+// ErrNoInteraction is returned when replaying a request that isn't in the cassette.
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// Mode tells whether a Cassette records or replays.
+type Mode string
+
+const (
+	// ModeReplay answers the requests with the recorded responses.
+	ModeReplay Mode = "replay"
+	// ModeRecord does the requests and records their responses.
+	ModeRecord Mode = "record"
+)
+
+// Cassette is a RoundTripper recording the responses of a job portal to replay
+// them in tests, so the test data is a real session and updating it is just
+// recording it again. Requests are matched by method, url and body hash, uuids
+// aside, and the same request done several times gets its responses in recorded order.
+// The session headers of the responses aren't recorded.
+type Cassette struct {
+	path string
+	mode Mode
+	rt   http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	played       map[string]int
+}
+
+// cassetteFile is how a Cassette is stored.
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	BodyHash string      `json:"body_hash"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     string      `json:"body"`
+}
+
+// NewCassette returns a cassette for the file in path, loading
+// its interactions to replay them with ModeReplay.
+func NewCassette(path string, mode Mode) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, played: make(map[string]int)}
+	switch mode {
+	case ModeRecord:
+		return c, nil
+	case ModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown mode %q in retryhttp.NewCassette", mode)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open cassette in retryhttp.NewCassette: %w", err)
+	}
+	defer f.Close()
+	var file cassetteFile
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("unable to decode cassette in retryhttp.NewCassette: %w", err)
+	}
+	c.interactions = file.Interactions
+	return c, nil
+}
+
+// WithCassette records or replays the requests with the cassette. When
+// recording, the requests go through the transport set by the previous
+// options, so WithProxyPool has to come before it to record through proxies.
+func WithCassette(cas *Cassette) Option {
+	return func(c *Client) {
+		cas.rt = c.client.Transport
+		if cas.rt == nil {
+			cas.rt = http.DefaultTransport
+		}
+		c.client.Transport = cas
+	}
+}
+
+// RoundTrip replays or records the request following the cassette's mode.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	hash, err := bodyHash(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == ModeReplay {
+		return c.replay(req, hash)
+	}
+
+	resp, err := c.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body in retryhttp.Cassette: %w", err)
+	}
+
+	header := resp.Header.Clone()
+	for _, h := range sessionHeaders {
+		header.Del(h)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := &Interaction{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		BodyHash: hash,
+		Status:   resp.StatusCode,
+		Header:   header,
+		Body:     string(body),
+	}
+	c.interactions = append(c.interactions, i)
+
+	// The scraper still gets the whole response, session included.
+	r := i.response(req)
+	r.Header = resp.Header
+	return r, nil
+}
+
+func (c *Cassette) replay(req *http.Request, hash string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := req.Method + " " + req.URL.String() + " " + hash
+
+	// The nth request gets the nth matching interaction,
+	// and the last one if there're no more.
+	var match *Interaction
+	n := c.played[key]
+	for _, i := range c.interactions {
+		if i.Method+" "+i.URL+" "+i.BodyHash != key {
+			continue
+		}
+		match = i
+		if n == 0 {
+			break
+		}
+		n--
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%w for %s %s in %s", ErrNoInteraction, req.Method, req.URL, c.path)
+	}
+	c.played[key]++
+	return match.response(req), nil
+}
+
+// Interactions returns the cassette's interactions in recorded order.
+func (c *Cassette) Interactions() []*Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.interactions)
+}
+
+// Save writes the recorded interactions into the cassette's file.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode cassette in retryhttp.Cassette.Save: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil { //nolint: gosec
+		return fmt.Errorf("unable to create cassette dir in retryhttp.Cassette.Save: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(b, '\n'), 0o644); err != nil { //nolint: gosec
+		return fmt.Errorf("unable to write cassette in retryhttp.Cassette.Save: %w", err)
+	}
+	return nil
+}
+
+func (i *Interaction) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Status, http.StatusText(i.Status)),
+		StatusCode:    i.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(i.Body))),
+		ContentLength: int64(len(i.Body)),
+		Request:       req,
+	}
+}
+
+// bodyHash returns the hex sha256 of the request's body without uuids, restoring it.
+func bodyHash(req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("unable to read request body in retryhttp.Cassette: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(randomID.ReplaceAll(body, nil))
+	return hex.EncodeToString(sum[:]), nil
+}
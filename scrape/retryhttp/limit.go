@@ -0,0 +1,116 @@
+package retryhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alwedo/jobber/metrics"
+)
+
+// WithRateLimit caps the requests per second sent by the client, allowing
+// bursts of up to burst requests. Every try of a retried request counts.
+// Scrapers share their client among all the queries, so it's a limit per
+// job portal no matter how many queries run at once.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		c.bucket = &bucket{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+	}
+}
+
+// WithMaxConcurrency caps the requests the client does at once,
+// retries included. A request keeps its turn until its response body
+// is closed, so callers must close it, even when Do returns an error
+// along with the response. Requests over the cap wait for their turn,
+// and requests waiting to be retried give theirs up meanwhile.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		c.slots = make(chan struct{}, n)
+	}
+}
+
+// acquire waits for a concurrency slot, returning the func releasing it.
+func (c *Client) acquire(req *http.Request) (func(), error) {
+	if c.slots == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	defer func() {
+		metrics.ScraperLimiterWait.WithLabelValues(req.URL.Host, "concurrency").Observe(time.Since(start).Seconds())
+	}()
+	select {
+	case c.slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-c.slots }) }, nil
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// releaseBody releases the concurrency slot of its response once closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// wait waits for the rate limit to allow a request.
+func (c *Client) wait(req *http.Request) error {
+	if c.bucket == nil {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		metrics.ScraperLimiterWait.WithLabelValues(req.URL.Host, "rate").Observe(time.Since(start).Seconds())
+	}()
+	return c.bucket.wait(req.Context())
+}
+
+// bucket is a token bucket refilled at rate tokens per second up to burst.
+// Waiters reserve their token right away, so they're served in order.
+type bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until a token is available or the context is done.
+func (b *bucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// The token is given back for the ones waiting after us.
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
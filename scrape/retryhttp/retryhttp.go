@@ -3,23 +3,41 @@
 //
 // The client retries requests when the response status code is classified as
 // retryable. A default set of retryable HTTP status codes is provided and can
-// be extended via options.
+// be extended via options. Retry-After headers are honored, and idempotent
+// requests are also retried on transient network errors.
+//
+// Options also cover what job portals expect from a well behaved visitor:
+// rate limits, proxies, and cookie sessions warmed up like a browser would.
 //
 // If retries are exhausted the client will respond with ErrRetrayble.
 package retryhttp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/alwedo/jobber/metrics"
 	ua "github.com/lib4u/fake-useragent"
 )
 
-const maxRetries = 5 // Exponential backoff limit.
+// Retry defaults, the backoff doubles the base delay
+// on every retry: 2s, 4s, 8s, 16s and 32s.
+const (
+	defaultMaxAttempts = 6
+	defaultBaseDelay   = 2 * time.Second
+	defaultMaxDelay    = time.Minute
+)
 
 var ErrRetryable = errors.New("too many retries")
 
@@ -34,17 +52,57 @@ func WithExtraRetryableStatus(status []int) Option {
 	}
 }
 
+// userAgents parses the user agents list once for all the clients.
+var userAgents = sync.OnceValues(ua.New)
+
 // WithRandomUserAgent will add a random User-Agent header for each http call.
+// If the user agents list can't be loaded the client's requests fail with
+// the error, since sending them without one would get them blocked anyway.
 func WithRandomUserAgent() Option {
 	return func(c *Client) {
-		u, err := ua.New()
+		u, err := userAgents()
 		if err != nil {
-			panic(err) // TODO: refactor to not panic
+			c.err = fmt.Errorf("failed to load user agents in retryhttp.WithRandomUserAgent: %w", err)
+			return
 		}
 		c.ua = u
 	}
 }
 
+// WithMaxAttempts sets how many times a request is tried, the first one included.
+func WithMaxAttempts(n int) Option {
+	return func(c *Client) {
+		c.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every
+// retry after it up to maxDelay. Retry-After headers asking to wait longer
+// than maxDelay make the client give up.
+func WithBackoff(base, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.baseDelay = base
+		c.maxDelay = maxDelay
+	}
+}
+
+// WithFullJitter waits a random duration up to the backoff delay before
+// each retry, so the clients blocked at once don't retry all at once.
+func WithFullJitter() Option {
+	return func(c *Client) {
+		c.jitter = true
+	}
+}
+
+// WithRetryHook calls f before waiting for every retry with the request,
+// the attempt about to be done and what failed: the status code of the
+// response, or the error if the request failed.
+func WithRetryHook(f func(req *http.Request, attempt, code int, err error)) Option {
+	return func(c *Client) {
+		c.onRetry = f
+	}
+}
+
 // WithTransport overwrites the http client
 // with a custom RoundTripper for testing.
 func WithTransport(rt http.RoundTripper) Option {
@@ -57,6 +115,17 @@ type Client struct {
 	client      *http.Client
 	isRetryable map[int]bool
 	ua          *ua.UserAgent
+	bucket      *bucket
+	slots       chan struct{}
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      bool
+	onRetry     func(req *http.Request, attempt, code int, err error)
+	proxies     *ProxyPool
+	jar         *jar
+	session     *session
+	err         error // Set by the options that failed to apply.
 }
 
 func New(opts ...Option) *Client {
@@ -71,6 +140,9 @@ func New(opts ...Option) *Client {
 			http.StatusServiceUnavailable:  true,
 			http.StatusGatewayTimeout:      true,
 		},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
 	}
 	for _, o := range opts {
 		o(c)
@@ -78,9 +150,13 @@ func New(opts ...Option) *Client {
 	return c
 }
 
-// Do executes the HTTP request with retry logic for retryable status codes.
+// Do executes the HTTP request with retry logic for retryable status codes,
+// and for transient network errors if the request is idempotent.
 // This implementation buffers and resets the body for each retry if req.Body is non-nil.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	// Buffer the body for retries.
 	if req.Body != nil {
 		bodyBytes, err := io.ReadAll(req.Body)
@@ -100,41 +176,179 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	var retries int
-	for {
-		if c.ua != nil {
-			req.Header.Set("User-Agent", c.ua.GetRandom())
+	for attempt := 1; ; attempt++ {
+		// The concurrency slot is held until the response body is closed,
+		// and given up while waiting for the next try so it doesn't hold
+		// back other requests.
+		release, err := c.acquire(req)
+		if err != nil {
+			return nil, fmt.Errorf("retryhttp.Do ctx cancelled waiting for a concurrency slot: %w", err)
+		}
+		var gen int
+		r := req
+		if c.session != nil {
+			header, pr, g, err := c.startSession(req.Context())
+			if err != nil {
+				release()
+				return nil, err
+			}
+			maps.Copy(req.Header, header)
+			gen = g
+			r = req.WithContext(pinProxy(req.Context(), pr))
 		}
 
-		resp, err := c.client.Do(req) //nolint: gosec
+		var delay time.Duration
+		resp, err := c.send(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to perform http request in retryhttp.Do: %w", err)
+			release()
+		} else {
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
 		}
-
-		if c.isRetryable[resp.StatusCode] {
-			if retries >= maxRetries {
+		if c.session != nil && err == nil && resp.StatusCode == http.StatusForbidden {
+			c.expireSession(gen)
+		}
+		switch {
+		case err != nil:
+			if attempt >= c.maxAttempts || !isIdempotent(req) || !isTransient(req.Context(), err) {
+				return nil, fmt.Errorf("failed to perform http request in retryhttp.Do: %w", err)
+			}
+			delay = c.backoff(attempt)
+		case c.isRetryable[resp.StatusCode]:
+			if attempt >= c.maxAttempts {
 				return resp, fmt.Errorf("%w with status code %d", ErrRetryable, resp.StatusCode)
 			}
+			var ok bool
+			if delay, ok = retryAfter(resp); !ok {
+				delay = c.backoff(attempt)
+			} else if delay > c.maxDelay {
+				// No point in waiting that long, the caller is better off trying later.
+				resp.Body.Close()
+				return nil, fmt.Errorf("%w with status code %d and Retry-After %s", ErrRetryable, resp.StatusCode, delay)
+			}
 			resp.Body.Close()
-			retries++
-
-			// While waiting for the next try we also listen for ctx cancellation.
-			t := time.NewTimer(time.Second << retries)
-			select {
-			case <-t.C:
-				// Reset the body and retry after the delay.
-				if req.Body != nil {
-					req.Body, err = req.GetBody()
-					if err != nil {
-						return nil, fmt.Errorf("failed to re-read request body in req.GetBody after a try: %w", err)
-					}
+		default:
+			return resp, nil
+		}
+
+		var code int
+		if resp != nil {
+			code = resp.StatusCode
+		}
+		metrics.ScraperRetries.WithLabelValues(req.URL.Host, retryReason(code)).Inc()
+		if c.onRetry != nil {
+			c.onRetry(req, attempt+1, code, err)
+		}
+
+		// While waiting for the next try we also listen for ctx cancellation.
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+			// Reset the body and retry after the delay.
+			if req.Body != nil {
+				req.Body, err = req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to re-read request body in req.GetBody after a try: %w", err)
 				}
-				continue
-			case <-req.Context().Done():
-				return nil, fmt.Errorf("retryhttp.Do ctx cancelled: %w", req.Context().Err())
 			}
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, fmt.Errorf("retryhttp.Do ctx cancelled: %w", req.Context().Err())
 		}
+	}
+}
+
+// send does the request once, within the rate limit and through the
+// proxies, counting the response in the context's stats.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if err := c.wait(req); err != nil {
+		return nil, fmt.Errorf("ctx cancelled waiting for the rate limit: %w", err)
+	}
+	if c.ua != nil {
+		req.Header.Set("User-Agent", c.ua.GetRandom())
+	}
+
+	r, report := c.withProxy(req)
+	resp, err := c.client.Do(r) //nolint: gosec
+	report(resp, err)
+	stats := statsFrom(req.Context())
+	if err != nil {
+		stats.record(0)
+		return nil, err
+	}
+	stats.record(resp.StatusCode)
+	return resp, nil
+}
+
+// backoff returns how long to wait after the given failed attempt:
+// the base delay doubled on every attempt up to the max delay, and
+// with full jitter a random duration up to that.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		d = min(c.baseDelay<<shift, c.maxDelay)
+	}
+	if c.jitter && d > 0 {
+		d = rand.N(d + 1) //nolint: gosec // no need for crypto/rand to spread retries.
+	}
+	return d
+}
+
+// retryAfter parses the response's Retry-After header,
+// given either in seconds or as an HTTP-date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return max(time.Duration(s)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// isIdempotent tells whether the request can be safely sent again after a network
+// error, when we can't know whether the server got it. It follows net/http.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// isTransient tells whether the network error is likely to go away by retrying.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
 
-		return resp, nil
+// retryReason is the label of a retry in the metrics, the
+// status code of the response or "network" for errors.
+func retryReason(code int) string {
+	if code == 0 {
+		return "network"
 	}
+	return strconv.Itoa(code)
 }
@@ -1,13 +1,23 @@
 package retryhttp_test
 
 import (
+	"context"
 	"errors"
 	"io"
+	"maps"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"testing/synctest"
+	"time"
 
 	"github.com/alwedo/jobber/scrape/retryhttp"
 )
@@ -115,6 +125,730 @@ func TestDo(t *testing.T) {
 	}
 }
 
+func TestStats(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		rh := retryhttp.New(retryhttp.WithTransport(&mock{t: t}))
+		ctx, stats := retryhttp.WithStats(t.Context())
+
+		for _, code := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, strconv.Itoa(code), http.NoBody)
+			if err != nil {
+				t.Fatalf("unable to create http request: %v", err)
+			}
+			_, _ = rh.Do(req) //nolint: bodyclose
+		}
+
+		// The 429 is retried until the retries are exhausted.
+		if want := "200: 2, 429: 6"; stats.String() != want {
+			t.Errorf("wanted stats %q, got %q", want, stats.String())
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []retryhttp.Option
+		header    func(now time.Time) string
+		wantSent  []time.Duration
+		wantRetry bool
+		wantResp  bool
+	}{
+		{
+			name:      "doubles the base delay up to the max delay",
+			opts:      []retryhttp.Option{retryhttp.WithMaxAttempts(5), retryhttp.WithBackoff(time.Second, 3*time.Second)},
+			wantSent:  []time.Duration{0, time.Second, 3 * time.Second, 6 * time.Second, 9 * time.Second},
+			wantRetry: true,
+			wantResp:  true,
+		},
+		{
+			name:      "waits the Retry-After seconds",
+			opts:      []retryhttp.Option{retryhttp.WithMaxAttempts(2)},
+			header:    func(time.Time) string { return "30" },
+			wantSent:  []time.Duration{0, 30 * time.Second},
+			wantRetry: true,
+			wantResp:  true,
+		},
+		{
+			name:      "waits until the Retry-After date",
+			opts:      []retryhttp.Option{retryhttp.WithMaxAttempts(2)},
+			header:    func(now time.Time) string { return now.Add(45 * time.Second).UTC().Format(http.TimeFormat) },
+			wantSent:  []time.Duration{0, 45 * time.Second},
+			wantRetry: true,
+			wantResp:  true,
+		},
+		{
+			name:      "gives up if Retry-After is over the max delay",
+			opts:      []retryhttp.Option{retryhttp.WithBackoff(time.Second, 10*time.Second)},
+			header:    func(time.Time) string { return "3600" },
+			wantSent:  []time.Duration{0},
+			wantRetry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				var (
+					sent   []time.Duration
+					closed bool
+				)
+				start := time.Now()
+				var header string
+				if tt.header != nil {
+					header = tt.header(start)
+				}
+				rh := retryhttp.New(append(tt.opts, retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+					sent = append(sent, time.Since(start))
+					closed = false
+					body := &closeRecorder{ReadCloser: http.NoBody, closed: &closed}
+					resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: body}
+					if header != "" {
+						resp.Header.Set("Retry-After", header)
+					}
+					return resp, nil
+				})))...)
+
+				req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+				if err != nil {
+					t.Fatalf("unable to create http request: %v", err)
+				}
+				resp, err := rh.Do(req) //nolint: bodyclose
+				if errors.Is(err, retryhttp.ErrRetryable) != tt.wantRetry {
+					t.Errorf("wanted ErrRetryable %t, got %v", tt.wantRetry, err)
+				}
+				if (resp != nil) != tt.wantResp {
+					t.Errorf("wanted a response %t, got %v", tt.wantResp, resp)
+				}
+				if resp == nil && !closed {
+					t.Errorf("wanted the response body to be closed when no response is returned")
+				}
+				if !slices.Equal(sent, tt.wantSent) {
+					t.Errorf("wanted requests sent at %v, got %v", tt.wantSent, sent)
+				}
+			})
+		})
+	}
+}
+
+func TestFullJitter(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sent []time.Time
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+				sent = append(sent, time.Now())
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			})),
+			retryhttp.WithBackoff(time.Second, time.Minute),
+			retryhttp.WithFullJitter(),
+		)
+
+		req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+		if err != nil {
+			t.Fatalf("unable to create http request: %v", err)
+		}
+		_, _ = rh.Do(req) //nolint: bodyclose
+
+		for i := 1; i < len(sent); i++ {
+			if gap, limit := sent[i].Sub(sent[i-1]), time.Second<<(i-1); gap > limit {
+				t.Errorf("wanted retry %d to wait up to %s, waited %s", i, limit, gap)
+			}
+		}
+	})
+}
+
+func TestNetworkErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		header    http.Header
+		err       error
+		wantCalls int
+	}{
+		{name: "retries idempotent requests", method: http.MethodGet, err: syscall.ECONNRESET, wantCalls: 3},
+		{name: "retries timeouts", method: http.MethodGet, err: &net.DNSError{IsTimeout: true}, wantCalls: 3},
+		{name: "does not retry non idempotent requests", method: http.MethodPost, err: syscall.ECONNRESET, wantCalls: 1},
+		{
+			name:      "retries requests with an idempotency key",
+			method:    http.MethodPost,
+			header:    http.Header{"Idempotency-Key": {"cuak"}},
+			err:       syscall.ECONNRESET,
+			wantCalls: 3,
+		},
+		{name: "does not retry permanent errors", method: http.MethodGet, err: &net.DNSError{IsNotFound: true}, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				var calls int
+				var hooked []int
+				rh := retryhttp.New(
+					retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+						calls++
+						return nil, tt.err
+					})),
+					retryhttp.WithMaxAttempts(3),
+					retryhttp.WithRetryHook(func(_ *http.Request, attempt, code int, err error) {
+						if code != 0 || !errors.Is(err, tt.err) {
+							t.Errorf("wanted the hook to get error %v, got code %d and error %v", tt.err, code, err)
+						}
+						hooked = append(hooked, attempt)
+					}),
+				)
+
+				req, err := http.NewRequest(tt.method, "http://portal.test", strings.NewReader("cuak"))
+				if err != nil {
+					t.Fatalf("unable to create http request: %v", err)
+				}
+				maps.Copy(req.Header, tt.header)
+				if _, err := rh.Do(req); !errors.Is(err, tt.err) { //nolint: bodyclose
+					t.Errorf("wanted error %v, got %v", tt.err, err)
+				}
+				if calls != tt.wantCalls {
+					t.Errorf("wanted %d calls, got %d", tt.wantCalls, calls)
+				}
+				// The hook gets every retry, with the attempt about to be done.
+				var wantHooked []int
+				for a := 2; a <= tt.wantCalls; a++ {
+					wantHooked = append(wantHooked, a)
+				}
+				if !slices.Equal(hooked, wantHooked) {
+					t.Errorf("wanted hooked attempts %v, got %v", wantHooked, hooked)
+				}
+			})
+		})
+	}
+}
+
+func TestSession(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var warmUps atomic.Int32
+		var forbidden atomic.Bool
+		forbidden.Store(true)
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(r *http.Request) (*http.Response, error) {
+				resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: r}
+				if r.URL.Path == "/landing" {
+					resp.Header.Set("Set-Cookie", "session="+strconv.Itoa(int(warmUps.Load())))
+					return resp, nil
+				}
+				if r.Header.Get("X-Token") == "" {
+					t.Errorf("wanted the session's X-Token header in %s", r.URL)
+				}
+				// The first session is rejected once.
+				if c, _ := r.Cookie("session"); c != nil && c.Value == "1" && forbidden.CompareAndSwap(true, false) {
+					resp.StatusCode = http.StatusForbidden
+				}
+				return resp, nil
+			})),
+			retryhttp.WithSession(func(ctx context.Context, do func(*http.Request) (*http.Response, error)) (http.Header, error) {
+				warmUps.Add(1)
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://portal.test/landing", http.NoBody)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := do(req)
+				if err != nil {
+					return nil, err
+				}
+				resp.Body.Close()
+				return http.Header{"X-Token": {"cuak"}}, nil
+			}),
+			retryhttp.WithExtraRetryableStatus([]int{http.StatusForbidden}),
+		)
+
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Go(func() {
+				req, err := http.NewRequest(http.MethodGet, "http://portal.test/search", http.NoBody)
+				if err != nil {
+					t.Errorf("unable to create http request: %v", err)
+					return
+				}
+				resp, err := rh.Do(req)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("wanted status 200, got %d", resp.StatusCode)
+				}
+			})
+		}
+		wg.Wait()
+
+		// One warm-up shared by the requests, and another after the 403.
+		if got := warmUps.Load(); got != 2 {
+			t.Errorf("wanted 2 warm-ups, got %d", got)
+		}
+	})
+}
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test_data", "cassette.json")
+	do := func(t *testing.T, rh *retryhttp.Client, method, body string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest(method, "http://portal.test/search", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unable to create http request: %v", err)
+		}
+		resp, err := rh.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unable to read response body: %v", err)
+		}
+		return string(b), nil
+	}
+
+	// The portal answers with the number of requests it got.
+	var calls int
+	cas, err := retryhttp.NewCassette(path, retryhttp.ModeRecord)
+	if err != nil {
+		t.Fatalf("unable to create cassette: %v", err)
+	}
+	rh := retryhttp.New(
+		retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+			calls++
+			header := http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"session=cuak"}}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(strconv.Itoa(calls)))}, nil
+		})),
+		retryhttp.WithCassette(cas),
+	)
+	for _, body := range []string{`{"page": 1}`, `{"page": 1}`, `{"page": 2, "id": "0a8e64ec-9a53-4c1b-8cf7-1d1c1b5c3e4a"}`} {
+		if _, err := do(t, rh, http.MethodPost, body); err != nil {
+			t.Fatalf("unexpected error recording: %v", err)
+		}
+	}
+	if err := cas.Save(); err != nil {
+		t.Fatalf("unable to save cassette: %v", err)
+	}
+
+	cas, err = retryhttp.NewCassette(path, retryhttp.ModeReplay)
+	if err != nil {
+		t.Fatalf("unable to load cassette: %v", err)
+	}
+	for _, i := range cas.Interactions() {
+		if i.Header.Get("Set-Cookie") != "" || i.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("wanted the session headers to be left out of the cassette, got %v", i.Header)
+		}
+	}
+	rh = retryhttp.New(retryhttp.WithCassette(cas))
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{name: "replays the first response", method: http.MethodPost, body: `{"page": 1}`, want: "1"},
+		{name: "replays repeated requests in order", method: http.MethodPost, body: `{"page": 1}`, want: "2"},
+		{name: "replays the last response once they run out", method: http.MethodPost, body: `{"page": 1}`, want: "2"},
+		{name: "ignores uuids in the body", method: http.MethodPost, body: `{"page": 2, "id": "5f0c1d7e-3b1a-4e8e-9b1a-6d2f0e8c7a11"}`, want: "3"},
+		{name: "matches the body", method: http.MethodPost, body: `{"page": 3}`, wantErr: retryhttp.ErrNoInteraction},
+		{name: "matches the method", method: http.MethodPut, body: `{"page": 1}`, wantErr: retryhttp.ErrNoInteraction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := do(t, rh, tt.method, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("wanted response %q, got %q", tt.want, got)
+			}
+		})
+	}
+	if calls != 3 {
+		t.Errorf("wanted the portal to get only the 3 recorded requests, got %d", calls)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var sent []time.Duration
+		start := time.Now()
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+				sent = append(sent, time.Since(start))
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+			retryhttp.WithRateLimit(1, 2),
+		)
+
+		for range 4 {
+			req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+			if err != nil {
+				t.Fatalf("unable to create http request: %v", err)
+			}
+			if _, err := rh.Do(req); err != nil { //nolint: bodyclose
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		// The burst goes right away, the rest one per second.
+		want := []time.Duration{0, 0, time.Second, 2 * time.Second}
+		if !slices.Equal(sent, want) {
+			t.Errorf("wanted requests sent at %v, got %v", want, sent)
+		}
+	})
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var inFlight, maxInFlight atomic.Int32
+		unblock := make(chan struct{})
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				if n > maxInFlight.Load() {
+					maxInFlight.Store(n)
+				}
+				<-unblock
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+			retryhttp.WithMaxConcurrency(2),
+		)
+
+		var wg sync.WaitGroup
+		for range 5 {
+			wg.Go(func() {
+				req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+				if err != nil {
+					t.Errorf("unable to create http request: %v", err)
+					return
+				}
+				resp, err := rh.Do(req)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				resp.Body.Close()
+			})
+		}
+
+		synctest.Wait()
+		if got := inFlight.Load(); got != 2 {
+			t.Errorf("wanted 2 requests in flight, got %d", got)
+		}
+		close(unblock)
+		wg.Wait()
+		if got := maxInFlight.Load(); got != 2 {
+			t.Errorf("wanted at most 2 requests in flight, got %d", got)
+		}
+	})
+}
+
+func TestMaxConcurrencyBackoff(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var retried atomic.Bool
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(r *http.Request) (*http.Response, error) {
+				if r.URL.Path == "/retry" && !retried.Swap(true) {
+					return &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}, Body: http.NoBody}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+			retryhttp.WithMaxConcurrency(1),
+		)
+		do := func(path string) {
+			req, err := http.NewRequest(http.MethodGet, "http://portal.test"+path, http.NoBody)
+			if err != nil {
+				t.Errorf("unable to create http request: %v", err)
+				return
+			}
+			resp, err := rh.Do(req)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}
+
+		start := time.Now()
+		done := make(chan struct{})
+		go func() {
+			do("/retry")
+			close(done)
+		}()
+		synctest.Wait()
+
+		// The retried request is waiting for its next try, which
+		// doesn't keep the other one from taking the slot.
+		do("/ok")
+		if waited := time.Since(start); waited != 0 {
+			t.Errorf("wanted the request not to wait for the retried one, waited %v", waited)
+		}
+		<-done
+	})
+}
+
+func TestMaxConcurrencyBody(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		rh := retryhttp.New(
+			retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+			retryhttp.WithMaxConcurrency(1),
+		)
+		do := func() *http.Response {
+			req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+			if err != nil {
+				t.Fatalf("unable to create http request: %v", err)
+			}
+			resp, err := rh.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return resp
+		}
+
+		first := do()
+		done := make(chan struct{})
+		go func() {
+			do().Body.Close()
+			close(done)
+		}()
+
+		// The first response is still being read, so the slot is taken.
+		synctest.Wait()
+		select {
+		case <-done:
+			t.Fatal("wanted the request to wait until the first body is closed")
+		default:
+		}
+
+		first.Body.Close()
+		// Closing it twice doesn't give up another request's slot.
+		first.Body.Close()
+		<-done
+	})
+}
+
+func TestLimitCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  retryhttp.Option
+	}{
+		{name: "waiting for the rate limit", opt: retryhttp.WithRateLimit(0.1, 1)},
+		{name: "waiting for a concurrency slot", opt: retryhttp.WithMaxConcurrency(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				unblock := make(chan struct{})
+				rh := retryhttp.New(
+					retryhttp.WithTransport(roundTripper(func(*http.Request) (*http.Response, error) {
+						<-unblock
+						return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+					})),
+					tt.opt,
+				)
+				do := func(ctx context.Context) error {
+					req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://portal.test", http.NoBody)
+					if err != nil {
+						t.Fatalf("unable to create http request: %v", err)
+					}
+					_, err = rh.Do(req) //nolint: bodyclose
+					return err
+				}
+
+				// The first request takes the token or the slot.
+				done := make(chan error)
+				go func() { done <- do(t.Context()) }()
+				synctest.Wait()
+
+				ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+				defer cancel()
+				if err := do(ctx); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("wanted context.DeadlineExceeded, got %v", err)
+				}
+
+				close(unblock)
+				if err := <-done; err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestProxyPool(t *testing.T) {
+	// standIn is a local proxy answering every request with the status it's set to.
+	type standIn struct {
+		*httptest.Server
+		status atomic.Int32
+		calls  atomic.Int32
+	}
+	newStandIn := func() *standIn {
+		p := &standIn{}
+		p.status.Store(http.StatusOK)
+		p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.calls.Add(1)
+			if r.URL.Host != "portal.test" {
+				t.Errorf("wanted the proxy to get a request for portal.test, got %s", r.URL)
+			}
+			w.WriteHeader(int(p.status.Load()))
+		}))
+		t.Cleanup(p.Close)
+		return p
+	}
+	do := func(t *testing.T, rh *retryhttp.Client) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "http://portal.test", http.NoBody)
+		if err != nil {
+			t.Fatalf("unable to create http request: %v", err)
+		}
+		resp, err := rh.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	newClient := func(t *testing.T, coolDown time.Duration, urls ...string) *retryhttp.Client {
+		t.Helper()
+		pool, err := retryhttp.NewProxyPool(urls, coolDown)
+		if err != nil {
+			t.Fatalf("unable to create proxy pool: %v", err)
+		}
+		return retryhttp.New(retryhttp.WithProxyPool(pool), retryhttp.WithBackoff(time.Millisecond, time.Millisecond))
+	}
+
+	t.Run("rotates over the proxies", func(t *testing.T) {
+		a, b := newStandIn(), newStandIn()
+		rh := newClient(t, time.Minute, a.URL, b.URL)
+		for range 4 {
+			do(t, rh)
+		}
+		if a.calls.Load() != 2 || b.calls.Load() != 2 {
+			t.Errorf("wanted 2 calls per proxy, got %d and %d", a.calls.Load(), b.calls.Load())
+		}
+	})
+
+	t.Run("leaves blocked proxies aside until they cool down", func(t *testing.T) {
+		a, b := newStandIn(), newStandIn()
+		a.status.Store(http.StatusTooManyRequests)
+		rh := newClient(t, 100*time.Millisecond, a.URL, b.URL)
+
+		// The request is retried through b, which gets the next ones too.
+		for range 3 {
+			do(t, rh)
+		}
+		if a.calls.Load() != 1 || b.calls.Load() != 3 {
+			t.Errorf("wanted 1 call to the blocked proxy and 3 to the other, got %d and %d", a.calls.Load(), b.calls.Load())
+		}
+
+		a.status.Store(http.StatusOK)
+		time.Sleep(150 * time.Millisecond)
+		for range 2 {
+			do(t, rh)
+		}
+		if a.calls.Load() != 2 {
+			t.Errorf("wanted the proxy to be used again after cooling down, got %d calls", a.calls.Load())
+		}
+	})
+
+	t.Run("leaves aside proxies failing to connect", func(t *testing.T) {
+		down, b := newStandIn(), newStandIn()
+		down.Close()
+		rh := newClient(t, time.Minute, down.URL, b.URL)
+		for range 3 {
+			do(t, rh)
+		}
+		if b.calls.Load() != 3 {
+			t.Errorf("wanted every request to go through the working proxy, got %d calls", b.calls.Load())
+		}
+	})
+
+	t.Run("sessions stick to their proxy", func(t *testing.T) {
+		a, b := newStandIn(), newStandIn()
+		pool, err := retryhttp.NewProxyPool([]string{a.URL, b.URL}, time.Minute)
+		if err != nil {
+			t.Fatalf("unable to create proxy pool: %v", err)
+		}
+		var warmUps atomic.Int32
+		rh := retryhttp.New(
+			retryhttp.WithProxyPool(pool),
+			retryhttp.WithBackoff(time.Millisecond, time.Millisecond),
+			retryhttp.WithSession(func(ctx context.Context, do func(*http.Request) (*http.Response, error)) (http.Header, error) {
+				warmUps.Add(1)
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://portal.test/landing", http.NoBody)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := do(req)
+				if err != nil {
+					return nil, err
+				}
+				resp.Body.Close()
+				return nil, nil
+			}),
+		)
+
+		// The warm-up and the requests of the session go through a.
+		for range 3 {
+			do(t, rh)
+		}
+		if a.calls.Load() != 4 || b.calls.Load() != 0 {
+			t.Errorf("wanted every call through the session's proxy, got %d and %d", a.calls.Load(), b.calls.Load())
+		}
+
+		// Once a is blocked the retry warms up a new session through b.
+		a.status.Store(http.StatusTooManyRequests)
+		do(t, rh)
+		if got := warmUps.Load(); got != 2 {
+			t.Errorf("wanted a new session for the new proxy, got %d warm-ups", got)
+		}
+		if b.calls.Load() != 2 {
+			t.Errorf("wanted the warm-up and the retry through the new proxy, got %d calls", b.calls.Load())
+		}
+	})
+
+	t.Run("rejects unsupported proxies", func(t *testing.T) {
+		if _, err := retryhttp.NewProxyPool([]string{"ftp://10.0.0.1"}, time.Minute); err == nil {
+			t.Error("wanted an error for an ftp proxy")
+		}
+	})
+
+	t.Run("from env", func(t *testing.T) {
+		t.Setenv("CUAK_PROXIES", "")
+		if p, err := retryhttp.ProxyPoolFromEnv("CUAK_PROXIES"); p != nil || err != nil {
+			t.Errorf("wanted no pool and no error for an empty env var, got %v and %v", p, err)
+		}
+		t.Setenv("CUAK_PROXIES", "http://10.0.0.1, socks5://10.0.0.2")
+		if p, err := retryhttp.ProxyPoolFromEnv("CUAK_PROXIES"); p == nil || err != nil {
+			t.Errorf("wanted a pool, got %v and %v", p, err)
+		}
+		t.Setenv("CUAK_PROXIES", "ftp://10.0.0.1")
+		if _, err := retryhttp.ProxyPoolFromEnv("CUAK_PROXIES"); err == nil {
+			t.Error("wanted an error for an ftp proxy")
+		}
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// closeRecorder records whether the body was closed.
+type closeRecorder struct {
+	io.ReadCloser
+	closed *bool
+}
+
+func (c *closeRecorder) Close() error {
+	*c.closed = true
+	return c.ReadCloser.Close()
+}
+
 // mock converts the url to the status code wanted to be returned.
 type mock struct {
 	t      testing.TB
@@ -0,0 +1,108 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+)
+
+// WarmUp starts a session with a job portal, ie. fetching its landing page
+// to get the cookies and CSRF tokens it checks before answering a search.
+// Requests done with do are tried once and keep their cookies in the
+// client's jar. The returned headers are set on every request of the session.
+type WarmUp func(ctx context.Context, do func(*http.Request) (*http.Response, error)) (http.Header, error)
+
+// WithCookieJar keeps the cookies the job portal sets between requests.
+func WithCookieJar() Option {
+	return func(c *Client) {
+		if c.jar == nil {
+			c.jar = &jar{}
+			c.client.Jar = c.jar
+		}
+	}
+}
+
+// WithSession warms up a session with warmUp before the first request, and
+// again after a 403 since it usually means the session expired. The session
+// is shared by all the requests of the client, so the pages of a scrape reuse it.
+// With a proxy pool the session is pinned to a proxy, and a new one is warmed
+// up through another proxy once it's left aside.
+func WithSession(warmUp WarmUp) Option {
+	return func(c *Client) {
+		WithCookieJar()(c)
+		c.session = &session{warmUp: warmUp}
+	}
+}
+
+// jar is a cookie jar that can be emptied.
+type jar struct {
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+}
+
+func (j *jar) current() *cookiejar.Jar {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.jar == nil {
+		j.jar, _ = cookiejar.New(nil) // It never fails without options.
+	}
+	return j.jar
+}
+
+func (j *jar) SetCookies(u *url.URL, cookies []*http.Cookie) { j.current().SetCookies(u, cookies) }
+
+func (j *jar) Cookies(u *url.URL) []*http.Cookie { return j.current().Cookies(u) }
+
+func (j *jar) reset() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar = nil
+}
+
+type session struct {
+	warmUp WarmUp
+
+	mu     sync.Mutex
+	header http.Header
+	proxy  *proxy // The proxy the session was warmed up through, if any.
+	gen    int    // Increased on every warm-up so concurrent 403s expire it once.
+	valid  bool   // Whether the current generation is still usable.
+}
+
+// startSession warms up the session unless it's already valid, returning
+// its headers, proxy and generation. Concurrent requests wait for it.
+func (c *Client) startSession(ctx context.Context) (http.Header, *proxy, int, error) {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.valid && (s.proxy == nil || c.proxies.healthy(s.proxy)) {
+		return s.header, s.proxy, s.gen, nil
+	}
+
+	c.jar.reset()
+	s.proxy = nil
+	if c.proxies != nil {
+		s.proxy = c.proxies.pick()
+	}
+	header, err := s.warmUp(pinProxy(ctx, s.proxy), c.send)
+	if err != nil {
+		s.valid = false
+		return nil, nil, 0, fmt.Errorf("failed to warm up session in retryhttp.startSession: %w", err)
+	}
+	s.header, s.valid = header, true
+	s.gen++
+	return s.header, s.proxy, s.gen, nil
+}
+
+// expireSession marks the session of the given generation for a new warm-up.
+func (c *Client) expireSession(gen int) {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen == gen {
+		s.valid = false
+	}
+}
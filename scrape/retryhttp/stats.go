@@ -0,0 +1,60 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type statsKey struct{}
+
+// Stats counts the responses to the requests done with a context, by
+// status code, so callers can tell what happened during a scrape.
+// Every try of a retried request is counted.
+type Stats struct {
+	mu     sync.Mutex
+	status map[int]int
+	errors int
+}
+
+// WithStats returns a context whose requests' responses are counted in the returned Stats.
+func WithStats(ctx context.Context) (context.Context, *Stats) {
+	s := &Stats{status: make(map[int]int)}
+	return context.WithValue(ctx, statsKey{}, s), s
+}
+
+func statsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// record counts a response's status code, or a failed request if it's 0.
+func (s *Stats) record(code int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code == 0 {
+		s.errors++
+		return
+	}
+	s.status[code]++
+}
+
+// String summarizes the stats, ie. "200: 3, 429: 2, error: 1".
+func (s *Stats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parts []string
+	for _, code := range slices.Sorted(maps.Keys(s.status)) {
+		parts = append(parts, fmt.Sprintf("%d: %d", code, s.status[code]))
+	}
+	if s.errors > 0 {
+		parts = append(parts, fmt.Sprintf("error: %d", s.errors))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -1,22 +1,35 @@
 // Package scrape defines the Scraper interface for extracting job offer data from external sources.
-// Implementations accept a query and return structured offer parameters for database insertion.
-// Includes a mock implementation for testing.
+// Implementations accept a query and yield structured offer parameters for database insertion,
+// a results page at a time. Includes a mock implementation for testing.
 package scrape
 
 import (
 	"context"
 	"fmt"
+	"iter"
+	"slices"
 	"time"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/scrape/glassdoor"
 	"github.com/alwedo/jobber/scrape/linkedin"
+	"github.com/alwedo/jobber/scrape/retryhttp"
 	"github.com/alwedo/jobber/scrape/stepstone"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // Scraper defines the interface expected from all the scrapers.
+// Scrape yields the offers of every results page as soon as it's fetched
+// so they can be persisted right away. An error ends the iteration, the
+// pages yielded before it are still valid.
 type Scraper interface {
-	Scrape(context.Context, *db.GetQueryScraperRow) ([]db.CreateOfferParams, error)
+	Scrape(context.Context, *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error]
+}
+
+// Checker is implemented by the scrapers that can tell
+// whether an offer was taken down from their job portal.
+type Checker interface {
+	IsGone(ctx context.Context, offerURL string) (bool, error)
 }
 
 // List links the name of the scraper to its implementation.
@@ -31,6 +44,24 @@ func New() List {
 	}
 }
 
+// FromEnv returns the list of all available scrapers configured by the
+// env vars, ie. the proxies of LinkedIn and Glassdoor.
+func FromEnv() (List, error) {
+	lp, err := retryhttp.ProxyPoolFromEnv("LINKEDIN_PROXIES")
+	if err != nil {
+		return nil, fmt.Errorf("configuring linkedin in scrape.FromEnv: %w", err)
+	}
+	gp, err := retryhttp.ProxyPoolFromEnv("GLASSDOOR_PROXIES")
+	if err != nil {
+		return nil, fmt.Errorf("configuring glassdoor in scrape.FromEnv: %w", err)
+	}
+	return List{
+		stepstone.Name: stepstone.New(),
+		linkedin.Name:  linkedin.New(linkedin.WithClientOptions(retryhttp.WithProxyPool(lp))),
+		glassdoor.Name: glassdoor.New(glassdoor.WithClientOptions(retryhttp.WithProxyPool(gp))),
+	}, nil
+}
+
 var (
 	Mock          = &mock{}
 	MockWithErr   = &mock{mockErr: fmt.Errorf("error")}
@@ -40,17 +71,33 @@ var (
 
 type mock struct {
 	LastQuery *db.GetQueryScraperRow
+	GoneURLs  []string
 	mockErr   error
 	delay     time.Duration
 }
 
-func (m *mock) Scrape(_ context.Context, q *db.GetQueryScraperRow) ([]db.CreateOfferParams, error) {
-	m.LastQuery = q
-	time.Sleep(m.delay)
+func (m *mock) Scrape(_ context.Context, q *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error] {
+	return func(yield func([]db.CreateOfferParams, error) bool) {
+		m.LastQuery = q
+		time.Sleep(m.delay)
+		if m.mockErr != nil {
+			yield(nil, m.mockErr)
+			return
+		}
+		yield([]db.CreateOfferParams{
+			{
+				ExternalID: q.Keywords + "-" + q.Location,
+				Title:      q.Keywords + " jobs in " + q.Location,
+				PostedAt:   pgtype.Timestamptz{Time: time.Now(), Valid: true},
+				Source:     "Mock",
+			},
+		}, nil)
+	}
+}
+
+func (m *mock) IsGone(_ context.Context, offerURL string) (bool, error) {
 	if m.mockErr != nil {
-		return nil, m.mockErr
+		return false, m.mockErr
 	}
-	return []db.CreateOfferParams{
-		{Title: q.Keywords + " jobs in " + q.Location},
-	}, nil
+	return slices.Contains(m.GoneURLs, offerURL), nil
 }
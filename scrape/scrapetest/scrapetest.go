@@ -0,0 +1,106 @@
+// Package scrapetest replays the cassettes of the scrapers' test_data in
+// their tests, so every scraper checks its recorded search the same way
+// and their mocks serve the recorded responses instead of their own files.
+//
+// The cassettes checked in aren't recorded sessions yet: their responses
+// are the fixtures the tests used before, and the Glassdoor warm-up is
+// written by hand. They replay what the scrapers ask, but not necessarily
+// what the portals answer today. Re-record them with make cassettes.
+package scrapetest
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"slices"
+	"testing"
+	"testing/synctest"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape/retryhttp"
+)
+
+// Scraper is the scrape.Scraper interface, which scrapers can't
+// import in their tests since the scrape package imports them.
+type Scraper interface {
+	Scrape(context.Context, *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error]
+}
+
+// Want is what replaying a cassette yields.
+type Want struct {
+	Source string
+	Pages  int
+	Offers int
+	// FirstID and LastID are the external ids of the first and last offers.
+	FirstID, LastID string
+}
+
+// Replay runs the query with the scraper replaying the cassette in path,
+// up to the wanted pages, and checks its offers against want.
+func Replay(t *testing.T, path string, newScraper func(...retryhttp.Option) Scraper, query *db.GetQueryScraperRow, want Want) {
+	t.Helper()
+	synctest.Test(t, func(t *testing.T) {
+		t.Helper()
+		s := newScraper(retryhttp.WithCassette(load(t, path)))
+
+		var pages [][]db.CreateOfferParams
+		for offers, err := range s.Scrape(t.Context(), query) {
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if pages = append(pages, offers); len(pages) == want.Pages {
+				break
+			}
+		}
+		if len(pages) != want.Pages {
+			t.Fatalf("expected %d pages, got %d", want.Pages, len(pages))
+		}
+		offers := slices.Concat(pages...)
+		if len(offers) != want.Offers {
+			t.Fatalf("expected %d offers, got %d", want.Offers, len(offers))
+		}
+		for _, o := range offers {
+			if o.ExternalID == "" || o.Title == "" || o.Company == "" || o.Url == "" || !o.PostedAt.Valid {
+				t.Errorf("expected offer to be complete, got %+v", o)
+			}
+			if o.Source != want.Source {
+				t.Errorf("expected source to be %s, got %s", want.Source, o.Source)
+			}
+		}
+		if got := offers[0].ExternalID; got != want.FirstID {
+			t.Errorf("expected first offer ID to be %s, got %s", want.FirstID, got)
+		}
+		if got := offers[len(offers)-1].ExternalID; got != want.LastID {
+			t.Errorf("expected last offer ID to be %s, got %s", want.LastID, got)
+		}
+	})
+}
+
+// Responses returns the bodies of the responses recorded in the cassette
+// in path for the requests to the url path, in recorded order.
+func Responses(t testing.TB, path, urlPath string) []string {
+	t.Helper()
+	var bodies []string
+	for _, i := range load(t, path).Interactions() {
+		u, err := url.Parse(i.URL)
+		if err != nil {
+			t.Fatalf("invalid url in cassette %s: %v", path, err)
+		}
+		if u.Path == urlPath {
+			bodies = append(bodies, i.Body)
+		}
+	}
+	if len(bodies) == 0 {
+		t.Fatalf("no responses for %s in cassette %s", urlPath, path)
+	}
+	return bodies
+}
+
+func load(t testing.TB, path string) *retryhttp.Cassette {
+	t.Helper()
+	cas, err := retryhttp.NewCassette(path, retryhttp.ModeReplay)
+	if err != nil {
+		t.Fatalf("unable to load cassette: %v", err)
+	}
+	return cas
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/scrape/liveness"
 	"github.com/alwedo/jobber/scrape/retryhttp"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -66,56 +68,103 @@ type item struct {
 	DatePosted  pgtype.Timestamptz `json:"datePosted"`
 }
 
+// goneRules describe how Stepstone shows the offers that were taken down.
+// Expired offers keep their page with a notice in the site's language.
+var goneRules = &liveness.Rules{
+	Status: []int{http.StatusNotFound, http.StatusGone},
+	Markers: []string{
+		"Diese Stellenanzeige ist nicht mehr verfügbar",
+		"This job ad is no longer available",
+	},
+}
+
 type stepstone struct {
-	client *retryhttp.Client
+	client     *retryhttp.Client
+	baseURL    string
+	clientOpts []retryhttp.Option
 }
 
-func New() *stepstone { //nolint: revive
-	return &stepstone{
-		client: retryhttp.New(retryhttp.WithRandomUserAgent()),
+// Option configures the Stepstone scraper.
+type Option func(*stepstone)
+
+// WithBaseURL points the scraper to another host than
+// www.stepstone.de, ie. a local stand-in in tests.
+func WithBaseURL(u string) Option {
+	return func(s *stepstone) {
+		s.baseURL = strings.TrimSuffix(u, "/")
 	}
 }
 
-func (s *stepstone) Scrape(ctx context.Context, query *db.GetQueryScraperRow) ([]db.CreateOfferParams, error) {
-	var totalOffers []db.CreateOfferParams
-	var totalCount int
-	var resp *response
-	var err error
+// WithClientOptions adds options to the scraper's client, applied after
+// its own ones, ie. to record its requests with retryhttp.WithCassette.
+func WithClientOptions(opts ...retryhttp.Option) Option {
+	return func(s *stepstone) {
+		s.clientOpts = append(s.clientOpts, opts...)
+	}
+}
 
-	for i := 1; ; i++ {
-		resp, err = s.fetchOffers(ctx, query, i)
-		if err != nil {
-			// If fetchOffers fails we return the accumulated offers so far and the error.
-			err = fmt.Errorf("failed to fetchOffers in stepstone.Scrape: %w", err)
-			break
-		}
-		if totalCount == 0 {
-			totalCount = resp.Pagination.TotalCount
-		}
-		for _, v := range resp.Items {
-			totalOffers = append(totalOffers, db.CreateOfferParams{
-				ID:          strconv.Itoa(v.ID),
-				Title:       v.Title,
-				Company:     v.CompanyName,
-				Location:    v.Location,
-				PostedAt:    v.DatePosted,
-				Description: v.TextSnippet,
-				Source:      Name,
-				Url:         stepstoneBaseURL + v.URL,
-			})
-		}
-		if resp.Pagination.PageCount == i {
-			break
-		}
+func New(opts ...Option) *stepstone { //nolint: revive
+	s := &stepstone{baseURL: stepstoneBaseURL}
+	for _, o := range opts {
+		o(s)
 	}
+	s.client = retryhttp.New(append([]retryhttp.Option{
+		retryhttp.WithRandomUserAgent(),
+		retryhttp.WithFullJitter(),
+		retryhttp.WithRateLimit(2, 5),
+		retryhttp.WithMaxConcurrency(4),
+	}, s.clientOpts...)...)
+	return s
+}
 
-	if totalCount > len(totalOffers) {
-		// This will prevent panic in case pagination fails before fetching
-		// all the offers or an amount that's bigger than totalCount.
-		return totalOffers, err
+// IsGone tells whether the offer was taken down from Stepstone.
+func (s *stepstone) IsGone(ctx context.Context, offerURL string) (bool, error) {
+	return liveness.Check(ctx, s.client, offerURL, goneRules)
+}
+
+// Scrape runs a stepstone search based on a query, yielding the
+// relevant offers of every results page until the last one.
+func (s *stepstone) Scrape(ctx context.Context, query *db.GetQueryScraperRow) iter.Seq2[[]db.CreateOfferParams, error] {
+	return func(yield func([]db.CreateOfferParams, error) bool) {
+		var totalOffers, totalCount int
+
+		for i := 1; ; i++ {
+			resp, err := s.fetchOffers(ctx, query, i)
+			if err != nil {
+				// The pages yielded so far have already been handled.
+				yield(nil, fmt.Errorf("failed to fetchOffers in stepstone.Scrape: %w", err))
+				return
+			}
+			if i == 1 {
+				totalCount = resp.Pagination.TotalCount
+			}
+			var offers []db.CreateOfferParams
+			for _, v := range resp.Items {
+				// Only the first totalCount offers are relevant.
+				// See response.Pagination.TotalCount.
+				if totalOffers+len(offers) == totalCount {
+					break
+				}
+				offers = append(offers, db.CreateOfferParams{
+					ExternalID:  strconv.Itoa(v.ID),
+					Title:       v.Title,
+					Company:     v.CompanyName,
+					Location:    v.Location,
+					PostedAt:    v.DatePosted,
+					Description: v.TextSnippet,
+					Source:      Name,
+					Url:         s.baseURL + v.URL,
+				})
+			}
+			totalOffers += len(offers)
+			if !yield(offers, nil) {
+				return
+			}
+			if resp.Pagination.PageCount <= i || totalOffers == totalCount {
+				return
+			}
+		}
 	}
-	// Return only valid offers. See response.Pagination.TotalCount.
-	return totalOffers[:totalCount], err
 }
 
 func (s *stepstone) fetchOffers(ctx context.Context, query *db.GetQueryScraperRow, page int) (*response, error) {
@@ -127,7 +176,7 @@ func (s *stepstone) fetchOffers(ctx context.Context, query *db.GetQueryScraperRo
 	// We use url.QueryEscape for the path values since we need spaces to be replaced with '+'.
 	// Leaving them as is and using url.Parse will replace them with '%20' and stepstone won't get proper results.
 	parsedURL, err := url.Parse(fmt.Sprintf(
-		stepstoneBaseURL+stepstoneSearchEndpoint,
+		s.baseURL+stepstoneSearchEndpoint,
 		url.QueryEscape(query.Keywords),
 		url.QueryEscape(query.Location),
 	))
@@ -150,7 +199,7 @@ func (s *stepstone) fetchOffers(ctx context.Context, query *db.GetQueryScraperRo
 	parsedURL.RawQuery = qp.Encode()
 
 	body := strings.NewReader(fmt.Sprintf(requestBody, parsedURL.String(), uuid.New().String()))
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stepstoneBaseURL+stepstonePublicAPIEndpoint, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+stepstonePublicAPIEndpoint, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request in stepstone.fetchOffers: %w", err)
 	}
@@ -159,10 +208,12 @@ func (s *stepstone) fetchOffers(ctx context.Context, query *db.GetQueryScraperRo
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to do http request in stepstone.fetchOffers: %w", err)
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
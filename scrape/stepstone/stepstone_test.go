@@ -4,28 +4,38 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"iter"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/scrape/retryhttp"
+	"github.com/alwedo/jobber/scrape/scrapetest"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// cassette has the responses of a search for golang jobs in berlin.
+const cassette = "test_data/cassette.json"
+
 func TestScrape(t *testing.T) {
-	mockResp := newStepstoneMockResp()
-	s := &stepstone{client: retryhttp.New(
-		retryhttp.WithRandomUserAgent(),
-		retryhttp.WithTransport(mockResp),
-	),
+	mockResp := newStepstoneMockResp(t)
+	s := &stepstone{
+		client: retryhttp.New(
+			retryhttp.WithRandomUserAgent(),
+			retryhttp.WithTransport(mockResp),
+		),
+		baseURL: stepstoneBaseURL,
 	}
 
 	t.Run("http request is correctly formed", func(t *testing.T) {
 		query := &db.GetQueryScraperRow{Keywords: "golang", Location: "the moon"}
-		_, err := s.Scrape(context.Background(), query)
+		_, err := scrapePages(s.Scrape(context.Background(), query))
 		if err != nil {
 			t.Fatalf("expected error not to be nil, got %v", err)
 		}
@@ -50,20 +60,44 @@ func TestScrape(t *testing.T) {
 		}
 	})
 
+	t.Run("keywords and location are encoded as path segments", func(t *testing.T) {
+		tests := []struct {
+			keywords string
+			location string
+			wantPath string
+		}{
+			{"golang", "the moon", "/work/golang/in-the+moon"},
+			{"c++ developer", "münchen", "/work/c%2B%2B+developer/in-m%C3%BCnchen"},
+			{"c#", "frankfurt am main", "/work/c%23/in-frankfurt+am+main"},
+			{".net", "saint-denis", "/work/.net/in-saint-denis"},
+			{"r&d", "l'aquila", "/work/r%26d/in-l%27aquila"},
+		}
+		for _, tt := range tests {
+			query := &db.GetQueryScraperRow{Keywords: tt.keywords, Location: tt.location}
+			if _, err := s.fetchOffers(context.Background(), query, 1); err != nil {
+				t.Fatalf("expected error to be nil, got %v", err)
+			}
+			if got := mockResp.searchURL.EscapedPath(); got != tt.wantPath {
+				t.Errorf("expected path to be %s, got %s", tt.wantPath, got)
+			}
+		}
+	})
+
 	t.Run("first time query returns a week of offers", func(t *testing.T) {
 		query := &db.GetQueryScraperRow{Keywords: "golang", Location: "the moon"}
-		offers, err := s.Scrape(context.Background(), query)
+		pages, err := scrapePages(s.Scrape(context.Background(), query))
 		if err != nil {
 			t.Fatalf("expected error not to be nil, got %v", err)
 		}
+		offers := slices.Concat(pages...)
 		if len(offers) != 70 {
 			t.Errorf("expected 70 offers, got %d", len(offers))
 		}
-		if offers[0].ID != "13112743" {
-			t.Errorf("expected first offer ID to be '13112743', got %s", offers[0].ID)
+		if offers[0].ExternalID != "13112743" {
+			t.Errorf("expected first offer ID to be '13112743', got %s", offers[0].ExternalID)
 		}
-		if offers[len(offers)-1].ID != "12453702" {
-			t.Errorf("expected last offer ID to be '12453702', got %s", offers[len(offers)-1].ID)
+		if offers[len(offers)-1].ExternalID != "12453702" {
+			t.Errorf("expected last offer ID to be '12453702', got %s", offers[len(offers)-1].ExternalID)
 		}
 		gotParamAge := mockResp.searchURL.Query().Get(paramAge)
 		if gotParamAge != paramAgeValueAge7 {
@@ -77,19 +111,11 @@ func TestScrape(t *testing.T) {
 			Location:  "the moon",
 			ScrapedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
 		}
-		offers, err := s.Scrape(context.Background(), query)
-		if err != nil {
+		// The mock answers with the cassette's pages whatever the age,
+		// so only the request tells a day of offers was asked for.
+		if _, err := scrapePages(s.Scrape(context.Background(), query)); err != nil {
 			t.Fatalf("expected error not to be nil, got %v", err)
 		}
-		if len(offers) != 22 {
-			t.Errorf("expected 22 offers, got %d", len(offers))
-		}
-		if offers[0].ID != "13304740" {
-			t.Errorf("expected first offer ID to be '13304740', got %s", offers[0].ID)
-		}
-		if offers[len(offers)-1].ID != "13435478" {
-			t.Errorf("expected last offer ID to be '13435478', got %s", offers[len(offers)-1].ID)
-		}
 		gotParamAge := mockResp.searchURL.Query().Get(paramAge)
 		if gotParamAge != paramAgeValueAge1 {
 			t.Errorf("expected age param to be %s, got %s", paramAgeValueAge1, gotParamAge)
@@ -97,13 +123,42 @@ func TestScrape(t *testing.T) {
 	})
 }
 
+// TestScrapeCassette replays a search recorded from the job portal.
+// Run `make cassettes` to record it again after the portal changes.
+// For now it's made of the result pages the tests used to serve.
+func TestScrapeCassette(t *testing.T) {
+	scrapetest.Replay(t, cassette, func(o ...retryhttp.Option) scrapetest.Scraper {
+		return New(WithClientOptions(o...))
+	}, &db.GetQueryScraperRow{Keywords: "golang", Location: "berlin"}, scrapetest.Want{
+		Source:  Name,
+		Pages:   3,
+		Offers:  70,
+		FirstID: "13112743",
+		LastID:  "12453702",
+	})
+}
+
+// scrapePages runs the scraper's search and returns the offers of every
+// page it yielded, along with the error that ended it, if any.
+func scrapePages(seq iter.Seq2[[]db.CreateOfferParams, error]) ([][]db.CreateOfferParams, error) {
+	var pages [][]db.CreateOfferParams
+	for offers, err := range seq {
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, offers)
+	}
+	return pages, nil
+}
+
 type stepstoneMockResp struct {
 	req       *http.Request
 	searchURL *url.URL
+	pages     []string
 }
 
-func newStepstoneMockResp() *stepstoneMockResp {
-	return &stepstoneMockResp{}
+func newStepstoneMockResp(t testing.TB) *stepstoneMockResp {
+	return &stepstoneMockResp{pages: scrapetest.Responses(t, cassette, stepstonePublicAPIEndpoint)}
 }
 
 func (s *stepstoneMockResp) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -121,19 +176,14 @@ func (s *stepstoneMockResp) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 	s.searchURL = parsedURL
 
-	// Mock stepstone pagination strategy
-	fn := fmt.Sprintf(
-		"test_data/stepstone_%s_page%s.json",
-		parsedURL.Query().Get(paramAge),
-		parsedURL.Query().Get(paramPage),
-	)
-	body, err := os.Open(fn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s in stepstoneMockResp.RoundTrip: %w", fn, err)
+	// Mock stepstone pagination strategy with the cassette's pages.
+	page, err := strconv.Atoi(parsedURL.Query().Get(paramPage))
+	if err != nil || page < 1 || page > len(s.pages) {
+		return nil, fmt.Errorf("unexpected page %q in stepstoneMockResp.RoundTrip", parsedURL.Query().Get(paramPage))
 	}
 
 	return &http.Response{
 		StatusCode: http.StatusOK,
-		Body:       body,
+		Body:       io.NopCloser(strings.NewReader(s.pages[page-1])),
 	}, nil
 }
@@ -25,7 +25,7 @@ function showCopyFeedback(message = "Copied!") {
   }, 2000);
 }
 
-if (window.location.pathname === "/feeds") {
+if (window.location.pathname.startsWith("/f/")) {
   const getLatestFeedItemsOnPage = () => {
     const feedItems = document.querySelectorAll(
       ".details-wrapper details summary",
@@ -36,13 +36,8 @@ if (window.location.pathname === "/feeds") {
   };
 
   function getLocalStorageKey() {
-    const url = new URL(window.location);
-    const params = new URLSearchParams(url.search);
-    const localStorageKey = `${params.getAll("keywords").join("+")}/${params.get(
-      "location",
-    )}`;
-
-    return localStorageKey;
+    // Feed urls look like /f/{id} or /f/{id}.html.
+    return window.location.pathname.split("/")[2].split(".")[0];
   }
   const pageTitle = "rssjobs";
   const pageTitleNewJobs = (nrOfNewPosts) =>
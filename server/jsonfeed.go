@@ -0,0 +1,159 @@
+package server
+
+import (
+	"slices"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/jobber"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// jsonFeedVersion is the JSON Feed spec version we implement.
+// See https://www.jsonfeed.org/version/1.1/
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+	Tags          []string         `json:"tags"`
+
+	// Jobber is a JSON Feed extension carrying the full offer.
+	// Extension keys must start with an underscore.
+	Jobber *jsonOffer `json:"_jobber"`
+}
+
+// jsonOffer is the JSON representation of a db.Offer.
+// It's used as is for the NDJSON export and as the
+// _jobber extension of JSON Feed items.
+type jsonOffer struct {
+	ID          string     `json:"id"`
+	InternalID  int64      `json:"internal_id"`
+	GroupID     *int64     `json:"group_id,omitempty"`
+	ExternalID  string     `json:"external_id"`
+	Title       string     `json:"title"`
+	Company     string     `json:"company"`
+	Location    string     `json:"location"`
+	PostedAt    time.Time  `json:"posted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Source      string     `json:"source"`
+	URL         string     `json:"url"`
+	Description string     `json:"description"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	// Duplicates are the same offer published in other sources.
+	Duplicates []*jsonOffer `json:"duplicates,omitempty"`
+}
+
+func newJSONOffer(o *jobber.Offer) *jsonOffer {
+	jo := toJSONOffer(o.Offer)
+	for _, d := range o.Duplicates {
+		jo.Duplicates = append(jo.Duplicates, toJSONOffer(d))
+	}
+	return jo
+}
+
+func toJSONOffer(o *db.Offer) *jsonOffer {
+	var groupID *int64
+	if o.GroupID.Valid {
+		groupID = &o.GroupID.Int64
+	}
+	return &jsonOffer{
+		ID:          offerGUID(o),
+		InternalID:  o.ID,
+		GroupID:     groupID,
+		ExternalID:  o.ExternalID,
+		Title:       o.Title,
+		Company:     o.Company,
+		Location:    o.Location,
+		PostedAt:    o.PostedAt.Time.UTC(),
+		CreatedAt:   o.CreatedAt.Time.UTC(),
+		Source:      o.Source,
+		URL:         o.Url,
+		Description: o.Description,
+		FirstSeenAt: o.FirstSeenAt.Time.UTC(),
+		LastSeenAt:  o.LastSeenAt.Time.UTC(),
+		UpdatedAt:   optionalTime(o.UpdatedAt),
+		CheckedAt:   optionalTime(o.CheckedAt),
+		ClosedAt:    optionalTime(o.ClosedAt),
+	}
+}
+
+// optionalTime returns nil for null timestamps so they're omitted.
+func optionalTime(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	u := t.Time.UTC()
+	return &u
+}
+
+func newJSONFeed(d *feedData) *jsonFeed {
+	title := d.Keywords + " jobs in " + d.Location
+	f := &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       title,
+		HomePageURL: d.HomeURL,
+		FeedURL:     d.URL + "." + formatJSON,
+		Description: title,
+		Authors:     []jsonFeedAuthor{{Name: "rssjobs"}},
+		Items:       make([]jsonFeedItem, 0, len(d.Offers)),
+	}
+	for _, o := range d.Offers {
+		// JSON Feed requires either content_html or content_text.
+		// Not every source provides a description so we fall back to the title.
+		content := o.Description
+		if content == "" {
+			content = o.Title + " at " + o.Company
+		}
+		var modified string
+		if o.UpdatedAt.Valid {
+			modified = o.UpdatedAt.Time.UTC().Format(time.RFC3339)
+		}
+		f.Items = append(f.Items, jsonFeedItem{
+			ID:            offerGUID(o.Offer),
+			URL:           o.Url,
+			Title:         offerTitle(o.Offer),
+			ContentText:   content,
+			DatePublished: o.FirstSeenAt.Time.UTC().Format(time.RFC3339),
+			DateModified:  modified,
+			Authors:       []jsonFeedAuthor{{Name: o.Company}},
+			Tags:          offerSources(o),
+			Jobber:        newJSONOffer(o),
+		})
+	}
+	return f
+}
+
+// offerSources returns the sources an offer was published in.
+func offerSources(o *jobber.Offer) []string {
+	sources := []string{o.Source}
+	for _, d := range o.Duplicates {
+		if !slices.Contains(sources, d.Source) {
+			sources = append(sources, d.Source)
+		}
+	}
+	return sources
+}
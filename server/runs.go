@@ -0,0 +1,81 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/google/uuid"
+)
+
+type jsonRuns struct {
+	ID       string    `json:"id"`
+	Keywords string    `json:"keywords"`
+	Location string    `json:"location"`
+	Runs     []jsonRun `json:"runs"`
+}
+
+// jsonRun is the JSON representation of a db.ScrapeRun.
+type jsonRun struct {
+	Scraper      string    `json:"scraper"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Pages        int32     `json:"pages"`
+	Offers       int32     `json:"offers"`
+	NewOffers    int32     `json:"new_offers"`
+	HTTPStatuses string    `json:"http_statuses"`
+	Error        string    `json:"error,omitempty"`
+}
+
+func newJSONRun(r *db.ScrapeRun) jsonRun {
+	return jsonRun{
+		Scraper:      r.ScraperName,
+		StartedAt:    r.StartedAt.Time,
+		FinishedAt:   r.FinishedAt.Time,
+		Pages:        r.Pages,
+		Offers:       r.Offers,
+		NewOffers:    r.NewOffers,
+		HTTPStatuses: r.HttpStatuses,
+		Error:        r.Error,
+	}
+}
+
+// runs responds with the latest scraper runs of the query as JSON,
+// newest first, to tell what happened when a feed looks empty.
+func (s *server) runs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ext, err := parseFeedID(r.PathValue(pathParamID))
+		if err != nil || ext != "" {
+			http.NotFound(w, r)
+			return
+		}
+		q, runs, err := s.jobber.ListRuns(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				s.internalError(w, "failed to list query runs in server.runs", err)
+			}
+			return
+		}
+
+		data := jsonRuns{
+			ID:       uuid.UUID(q.PublicID.Bytes).String(),
+			Keywords: q.Keywords,
+			Location: q.Location,
+			Runs:     make([]jsonRun, 0, len(runs)),
+		}
+		for _, run := range runs {
+			data.Runs = append(data.Runs, newJSONRun(run))
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Add("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			s.internalError(w, "failed to encode runs in server.runs", err)
+		}
+	}
+}
@@ -1,44 +1,70 @@
 package server
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"iter"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/jobber"
 	"github.com/alwedo/jobber/metrics"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
 	// Path Params.
 	pathParamStatic = "static"
+	pathParamID     = "id"
 
 	// Query Params.
 	queryParamKeywords = "keywords"
 	queryParamLocation = "location"
+	queryParamFormat   = "format"
+	queryParamSource   = "source"
+
+	// Optional feed filters. Each one takes a comma separated list of terms.
+	queryParamExclude      = "exclude"
+	queryParamTitleInclude = "title_include"
+	queryParamTitleExclude = "title_exclude"
+
+	// Feed formats.
+	formatRSS    = "rss"
+	formatAtom   = "atom"
+	formatHTML   = "html"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
 
 	// Static assets.
 	assetStyle  = "assets/css/style.css"
 	assetScript = "assets/js/script.js"
 
 	// Templates.
-	tmplIndex          = "index.gohtml"
-	tmplHelp           = "help.gohtml"
-	tmplFeedRSS        = "feed_rss.goxml"
-	tmplFeedHTML       = "feed_html.gohtml"
-	tmplCreateResponse = "create_response.gohtml"
+	tmplIndex            = "index.gohtml"
+	tmplHelp             = "help.gohtml"
+	tmplFeedHTML         = "feed_html.gohtml"
+	tmplCreateResponse   = "create_response.gohtml"
+	tmplOfferDescription = "offer_description.gohtml"
+	tmplProgress         = "progress.gohtml"
+	tmplStatus           = "status.gohtml"
 )
 
 //go:embed assets/*
@@ -48,9 +74,11 @@ var assets embed.FS
 var isMainStyle = regexp.MustCompile(`^style\.v[\d.]+\.css$`)
 var isMainScript = regexp.MustCompile(`^script\.v[\d.]+\.js$`)
 
-// Input validation regex.
-var isValidKeywords = regexp.MustCompile(`^[A-Za-z0-9 ]+$`)
-var isValidLocation = regexp.MustCompile(`^[A-Za-z ]+$`)
+// Input validation regex. Besides letters (and their combining marks)
+// we allow a small set of punctuation found in real searches, ie.
+// "c++", "c#", ".net", "frankfurt am main", "saint-denis" or "st. gallen".
+var isValidKeywords = regexp.MustCompile(`^[\p{L}\p{M}\p{N} +#.&'-]+$`)
+var isValidLocation = regexp.MustCompile(`^[\p{L}\p{M} .'-]+$`)
 
 type server struct {
 	logger    *slog.Logger
@@ -59,16 +87,20 @@ type server struct {
 }
 
 func New(l *slog.Logger, j *jobber.Jobber) (*http.Server, error) {
-	t, err := template.New("").Funcs(funcMap).ParseFS(assets, "assets/templates/*")
+	t, err := parseTemplates()
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse templates: %v", err)
+		return nil, err
 	}
 	s := &server{logger: l, jobber: j, templates: t}
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /feeds", s.feed())
+	mux.HandleFunc("GET /feeds", s.legacyFeed())
+	mux.HandleFunc("GET /f/{id}", s.feed())
+	mux.HandleFunc("GET /f/{id}/progress", s.progress())
+	mux.HandleFunc("GET /f/{id}/runs", s.runs())
 	mux.HandleFunc("POST /feeds", s.create())
 	mux.Handle("GET /metrics", promhttp.Handler())
 	mux.HandleFunc("GET /help", s.help())
+	mux.HandleFunc("GET /status", s.status())
 	mux.HandleFunc("GET /", s.index())
 	mux.HandleFunc("GET /static/{static}", s.static())
 
@@ -79,13 +111,24 @@ func New(l *slog.Logger, j *jobber.Jobber) (*http.Server, error) {
 	}, nil
 }
 
+// parseTemplates parses the HTML templates. Using html/template
+// ensures scraped values are escaped according to their context.
+func parseTemplates() (*template.Template, error) {
+	t, err := template.New("").Funcs(funcMap).ParseFS(assets, "assets/templates/*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse templates: %v", err)
+	}
+	return t, nil
+}
+
 func (s *server) index() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
 		}
-		if err := s.templates.ExecuteTemplate(w, tmplIndex, nil); err != nil {
+		data := struct{ Sources []string }{s.jobber.Sources()}
+		if err := s.templates.ExecuteTemplate(w, tmplIndex, data); err != nil {
 			s.internalError(w, "failed to execute template in server.index", err)
 			return
 		}
@@ -101,6 +144,18 @@ func (s *server) help() http.HandlerFunc {
 	}
 }
 
+// status renders the state of the scrapers' circuit breakers.
+func (s *server) status() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		data := struct{ Circuits []jobber.Circuit }{s.jobber.Circuits()}
+		w.Header().Set("Cache-Control", "no-store")
+		if err := s.templates.ExecuteTemplate(w, tmplStatus, data); err != nil {
+			s.internalError(w, "failed to execute template in server.status", err)
+			return
+		}
+	}
+}
+
 func (s *server) create() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params, err := validateParams([]string{queryParamKeywords, queryParamLocation}, w, r)
@@ -108,32 +163,42 @@ func (s *server) create() http.HandlerFunc {
 			s.logger.Info("missing params in server.create", slog.String("error", err.Error()))
 			return
 		}
-
-		var timedOut bool
-		if err := s.jobber.CreateQuery(r.Context(), params.Get(queryParamKeywords), params.Get(queryParamLocation)); err != nil {
-			if errors.Is(err, jobber.ErrTimedOut) {
-				timedOut = true
-			} else {
-				s.internalError(w, "failed to create query", err)
-				return
-			}
+		filters, err := validateFilters(w, r)
+		if err != nil {
+			s.logger.Info("invalid filters in server.create", slog.String("error", err.Error()))
+			return
+		}
+		sources, err := s.validateSources(w, r)
+		if err != nil {
+			s.logger.Info("invalid sources in server.create", slog.String("error", err.Error()))
+			return
 		}
 
-		scheme := "https://"
-		if r.Host == "localhost" {
-			scheme = "http://"
+		q, err := s.jobber.CreateQuery(r.Context(), &db.CreateQueryParams{
+			Keywords:        params.Get(queryParamKeywords),
+			Location:        params.Get(queryParamLocation),
+			ExcludeKeywords: filters[queryParamExclude],
+			TitleInclude:    filters[queryParamTitleInclude],
+			TitleExclude:    filters[queryParamTitleExclude],
+			Sources:         sources,
+		})
+		if err != nil {
+			s.internalError(w, "failed to create query", err)
+			return
 		}
-		u, err := url.Parse(scheme + r.Host + "/feeds")
+
+		u, err := feedURL(r, q.PublicID)
 		if err != nil {
 			s.internalError(w, "failed to parse url in server.create", err)
 			return
 		}
-		u.RawQuery = params.Encode()
 
+		// The offers are fetched in the background. The response
+		// polls the query's progress until every scraper finishes.
 		data := struct {
-			URL      string
-			TimedOut bool
-		}{u.String(), timedOut}
+			URL         string
+			ProgressURL string
+		}{u.String(), progressPath(q.PublicID)}
 
 		if err := s.templates.ExecuteTemplate(w, tmplCreateResponse, data); err != nil {
 			s.internalError(w, "failed to execute template in server.create", err)
@@ -142,74 +207,381 @@ func (s *server) create() http.HandlerFunc {
 	}
 }
 
+// progress renders the state of the query's scrapers. It's polled with htmx
+// from the create response, and the polling stops once they all finished.
+func (s *server) progress() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ext, err := parseFeedID(r.PathValue(pathParamID))
+		if err != nil || ext != "" {
+			http.NotFound(w, r)
+			return
+		}
+		q, progress, err := s.jobber.Progress(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				s.internalError(w, "failed to get query progress in server.progress", err)
+			}
+			return
+		}
+
+		data := struct {
+			URL      string
+			Finished bool
+			Scrapers []*db.QueryScraperStatus
+		}{progressPath(q.PublicID), jobber.Finished(progress), progress}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := s.templates.ExecuteTemplate(w, tmplProgress, data); err != nil {
+			s.internalError(w, "failed to execute template in server.progress", err)
+			return
+		}
+	}
+}
+
+// progressPath returns the path of the query's progress.
+func progressPath(id pgtype.UUID) string {
+	return "/f/" + uuid.UUID(id.Bytes).String() + "/progress"
+}
+
 type feedData struct {
-	Keywords string
-	Location string
-	Host     string
-	Offers   []*db.Offer
+	ID        string
+	Keywords  string
+	Location  string
+	Hostname  string
+	HomeURL   string
+	URL       string
+	UpdatedAt time.Time
+	Offers    []*jobber.Offer
 }
 
-func (s *server) feed() http.HandlerFunc {
+// offerGUID returns the stable identifier of an offer in the feeds.
+// Offer ids are only unique within a job portal, so they're namespaced
+// by their source.
+func offerGUID(o *db.Offer) string {
+	return strings.ToLower(o.Source) + ":" + o.ExternalID
+}
+
+// offerTitle returns the title of an offer in the feeds, marking
+// the offers whose fields changed since they were first seen.
+func offerTitle(o *db.Offer) string {
+	title := o.Title + " at " + o.Company
+	if o.UpdatedAt.Valid {
+		title += " (updated)"
+	}
+	return title
+}
+
+// legacyFeed keeps the feed urls addressed by keywords and location
+// working by redirecting them to the query's stable url.
+func (s *server) legacyFeed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params, err := validateParams([]string{queryParamKeywords, queryParamLocation}, w, r)
 		if err != nil {
-			s.logger.Info("missing params in server.feed", slog.String("error", err.Error()))
+			s.logger.Info("missing params in server.legacyFeed", slog.String("error", err.Error()))
 			return
 		}
-		var (
-			keywords = params.Get(queryParamKeywords)
-			location = params.Get(queryParamLocation)
-		)
 
-		offers, updatedAt, err := s.jobber.ListOffers(r.Context(), &db.GetQueryParams{
-			Keywords: keywords,
-			Location: location,
+		q, err := s.jobber.GetQuery(r.Context(), &db.GetQueryParams{
+			KeywordsKey: jobber.SearchKey(params.Get(queryParamKeywords)),
+			LocationKey: jobber.SearchKey(params.Get(queryParamLocation)),
 		})
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				http.NotFound(w, r)
 			} else {
-				s.internalError(w, "failed to get query in server.feed", err)
+				s.internalError(w, "failed to get query in server.legacyFeed", err)
+			}
+			return
+		}
+
+		// An explicit format is kept as the extension of the new url.
+		// Otherwise clients keep negotiating it with the Accept header.
+		path := "/f/" + uuid.UUID(q.PublicID.Bytes).String()
+		switch f := r.FormValue(queryParamFormat); f {
+		case formatRSS, formatAtom, formatHTML, formatJSON, formatNDJSON:
+			path += "." + f
+		}
+		if src := r.Form[queryParamSource]; len(src) > 0 {
+			path += "?" + url.Values{queryParamSource: src}.Encode()
+		}
+		http.Redirect(w, r, path, http.StatusMovedPermanently)
+	}
+}
+
+func (s *server) feed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ext, err := parseFeedID(r.PathValue(pathParamID))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		format := feedFormat(r, ext)
+		sources, err := s.validateSources(w, r)
+		if err != nil {
+			s.logger.Info("invalid sources in server.feed", slog.String("error", err.Error()))
+			return
+		}
+
+		// Feed readers poll constantly. We check whether the feed changed
+		// before listing the offers so unchanged feeds get a cheap 304.
+		v, err := s.jobber.FeedVersion(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				s.internalError(w, "failed to get query version in server.feed", err)
 			}
 			return
 		}
-		if updatedAt != nil && updatedAt.Valid {
+		if v.UpdatedAt.Valid {
 			// We set a Cache-Control header with max-age so clients don't
 			// waste time re-fetching information that hasn't been updated.
 			// Since the queries get updated hourly, we want the max-age value
 			// to be time in seconds until the next update.
 			// If the calculated value is more than one hour we don't retun the
 			// header since we can't guarantee when the next update will be.
-			lastUpdate := time.Since(updatedAt.Time)
+			lastUpdate := time.Since(v.UpdatedAt.Time)
 			if lastUpdate < time.Hour {
 				t := time.Hour - lastUpdate
 				w.Header().Add("Cache-Control", "max-age="+strconv.Itoa(int(t.Seconds())))
 			}
 		}
 
-		var tmpl string
-		// Set template and Content-Type header based on Accept header.
-		// If Accept header is 'text/html' we assue the request is coming
-		// from a browser, otherwise it's an RSS reader.
-		switch strings.Contains(r.Header.Get("Accept"), "text/html") {
-		case true:
-			tmpl = tmplFeedHTML
+		etag := feedETag(v, format, r.URL.Query())
+		lastModified := v.CreatedAt.Time
+		if v.FeedUpdatedAt.Valid {
+			lastModified = v.FeedUpdatedAt.Time
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		// The representation depends on the Accept header.
+		w.Header().Set("Vary", "Accept")
+		if notModified(r, etag, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if format == formatNDJSON {
+			w.Header().Add("Content-Type", "application/x-ndjson")
+			s.streamNDJSON(w, s.jobber.ExportOffers(r.Context(), v.ID, sources))
+			return
+		}
+
+		offers, q, err := s.jobber.ListOffers(r.Context(), id, sources)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.NotFound(w, r)
+			} else {
+				s.internalError(w, "failed to get query in server.feed", err)
+			}
+			return
+		}
+
+		home := baseURL(r)
+		u, err := feedURL(r, q.PublicID)
+		if err != nil {
+			s.internalError(w, "failed to parse url in server.feed", err)
+			return
+		}
+
+		// Atom feeds require an updated timestamp. If the query hasn't
+		// been scraped yet we fall back to the most recent offer, and
+		// to the current time if there are no offers at all.
+		var feedUpdatedAt time.Time
+		switch {
+		case q.UpdatedAt.Valid:
+			feedUpdatedAt = q.UpdatedAt.Time
+		case len(offers) > 0:
+			feedUpdatedAt = offers[0].PostedAt.Time
+		default:
+			feedUpdatedAt = time.Now()
+		}
+
+		data := &feedData{
+			ID:        uuid.UUID(q.PublicID.Bytes).String(),
+			Keywords:  q.Keywords,
+			Location:  q.Location,
+			Hostname:  home.Hostname(),
+			HomeURL:   home.String(),
+			URL:       u.String(),
+			UpdatedAt: feedUpdatedAt,
+			Offers:    offers,
+		}
+
+		switch format {
+		case formatHTML:
 			w.Header().Add("Content-Type", "text/html")
+			if err := s.templates.ExecuteTemplate(w, tmplFeedHTML, data); err != nil {
+				s.internalError(w, "failed to execute template in server.feed", err)
+			}
+		case formatAtom:
+			f, err := s.newAtom(data)
+			if err != nil {
+				s.internalError(w, "failed to build Atom feed in server.feed", err)
+				return
+			}
+			w.Header().Add("Content-Type", "application/atom+xml")
+			if err := writeXML(w, f); err != nil {
+				s.internalError(w, "failed to encode Atom feed in server.feed", err)
+			}
+		case formatJSON:
+			w.Header().Add("Content-Type", "application/feed+json")
+			if err := json.NewEncoder(w).Encode(newJSONFeed(data)); err != nil {
+				s.internalError(w, "failed to encode JSON feed in server.feed", err)
+			}
 		default:
-			tmpl = tmplFeedRSS
+			f, err := s.newRSS(data)
+			if err != nil {
+				s.internalError(w, "failed to build RSS feed in server.feed", err)
+				return
+			}
 			w.Header().Add("Content-Type", "application/rss+xml")
+			if err := writeXML(w, f); err != nil {
+				s.internalError(w, "failed to encode RSS feed in server.feed", err)
+			}
 		}
+	}
+}
 
-		if err := s.templates.ExecuteTemplate(w, tmpl, &feedData{
-			Keywords: keywords,
-			Location: location,
-			Host:     r.Host,
-			Offers:   offers,
-		}); err != nil {
-			s.internalError(w, "failed to execute template in server.feed", err)
+// streamNDJSON writes one JSON encoded offer per line as the pages are
+// read, flushing after each page so clients can start processing right away.
+// Once the first offer is written the response can't be turned into
+// an error anymore, so failures are only logged.
+func (s *server) streamNDJSON(w http.ResponseWriter, pages iter.Seq2[[]*db.Offer, error]) {
+	enc := json.NewEncoder(w)
+	f, canFlush := w.(http.Flusher)
+	var written int
+	for page, err := range pages {
+		if err != nil {
+			if written == 0 {
+				s.internalError(w, "failed to list offers in server.streamNDJSON", err)
+				return
+			}
+			s.logger.Error("failed to list offers in server.streamNDJSON", slog.Int("offer", written), slog.String("error", err.Error()))
 			return
 		}
+		for _, o := range page {
+			if err := enc.Encode(toJSONOffer(o)); err != nil {
+				if written == 0 {
+					s.internalError(w, "failed to encode offer in server.streamNDJSON", err)
+					return
+				}
+				s.logger.Error("failed to stream offer in server.streamNDJSON", slog.Int("offer", written), slog.String("error", err.Error()))
+				return
+			}
+			written++
+		}
+		if canFlush {
+			f.Flush()
+		}
+	}
+}
+
+// parseFeedID parses the feed id path param. The id can have a format
+// extension, ie. '{id}.rss', which is returned along with the id.
+func parseFeedID(s string) (pgtype.UUID, string, error) {
+	raw, ext, _ := strings.Cut(s, ".")
+	switch ext {
+	case "", formatRSS, formatAtom, formatHTML, formatJSON, formatNDJSON:
+	default:
+		return pgtype.UUID{}, "", fmt.Errorf("unknown feed extension %q", ext)
+	}
+	// We only accept the canonical form so every feed has a single url.
+	if len(raw) != 36 {
+		return pgtype.UUID{}, "", fmt.Errorf("invalid feed id %q", raw)
+	}
+	u, err := uuid.Parse(raw)
+	if err != nil {
+		return pgtype.UUID{}, "", fmt.Errorf("invalid feed id %q: %w", raw, err)
+	}
+	return pgtype.UUID{Bytes: u, Valid: true}, ext, nil
+}
+
+// feedFormat returns the format the feed should be rendered in.
+// The url extension takes precedence over an explicit 'format' query
+// param, which takes precedence over the Accept header.
+// If Accept header is 'text/html' we assume the request is coming from a
+// browser, otherwise it's a feed reader and we default to RSS.
+func feedFormat(r *http.Request, ext string) string {
+	if ext != "" {
+		return ext
+	}
+	switch f := r.FormValue(queryParamFormat); f {
+	case formatRSS, formatAtom, formatHTML, formatJSON, formatNDJSON:
+		return f
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/atom+xml"):
+		return formatAtom
+	case strings.Contains(accept, "application/feed+json"):
+		return formatJSON
+	case strings.Contains(accept, "application/x-ndjson"):
+		return formatNDJSON
+	case strings.Contains(accept, "text/html"):
+		return formatHTML
+	default:
+		return formatRSS
+	}
+}
+
+// feedETag returns a strong ETag for a feed representation. The query's
+// feed update time changes on every scrape and whenever its offers are
+// closed or deleted, so it identifies the offer set.
+// The format and request params are included since every representation
+// of the feed must have its own ETag.
+func feedETag(v *db.GetQueryVersionRow, format string, params url.Values) string {
+	var updatedAt int64
+	if v.FeedUpdatedAt.Valid {
+		updatedAt = v.FeedUpdatedAt.Time.UnixNano()
 	}
+	h := sha256.Sum256(fmt.Appendf(nil, "%d|%d|%s|%s", v.ID, updatedAt, format, params.Encode()))
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since request
+// headers as described in RFC 9110 section 13.2.2. If-Modified-Since is
+// ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for t := range strings.SplitSeq(inm, ",") {
+			t = strings.TrimSpace(t)
+			// If-None-Match uses the weak comparison function.
+			if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// HTTP dates have a one second resolution.
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// baseURL returns the scheme and host the request was made to. The server
+// runs behind a TLS terminating proxy, so requests are https unless the
+// proxy says otherwise or they're made to localhost.
+func baseURL(r *http.Request) *url.URL {
+	u := &url.URL{Scheme: "https", Host: r.Host}
+	switch proto := r.Header.Get("X-Forwarded-Proto"); {
+	case proto == "http" || proto == "https":
+		u.Scheme = proto
+	case r.TLS == nil && u.Hostname() == "localhost":
+		u.Scheme = "http"
+	}
+	return u
+}
+
+// feedURL returns the absolute URL of the feed with the given public id.
+func feedURL(r *http.Request, id pgtype.UUID) (*url.URL, error) {
+	return url.Parse(baseURL(r).String() + "/f/" + uuid.UUID(id.Bytes).String())
 }
 
 func (s *server) static() http.HandlerFunc {
@@ -280,15 +652,16 @@ func validateParams(params []string, w http.ResponseWriter, r *http.Request) (ur
 	invalid := []string{}
 	valid := url.Values{}
 	for _, p := range params {
-		v := r.FormValue(p)
+		v := normalizeParam(r.FormValue(p))
 		switch {
 		case v == "":
 			missing = append(missing, p)
 		case p == queryParamKeywords && !isValidKeywords.MatchString(v) ||
-			p == queryParamLocation && !isValidLocation.MatchString(v):
+			p == queryParamLocation && !isValidLocation.MatchString(v) ||
+			!strings.ContainsFunc(v, isAlphanumeric):
 			invalid = append(invalid, p)
 		default:
-			valid.Add(p, strings.ToLower(strings.TrimSpace(v)))
+			valid.Add(p, v)
 		}
 	}
 	if len(missing) != 0 || len(invalid) != 0 {
@@ -298,7 +671,7 @@ func validateParams(params []string, w http.ResponseWriter, r *http.Request) (ur
 			errStr = append(errStr, fmt.Sprintf("missing params: %v", missing))
 		}
 		if len(invalid) != 0 {
-			errStr = append(errStr, fmt.Sprintf("invalid params: %v, only [A-Za-z0-9] allowed for keywords and [A-Za-z] for location", invalid))
+			errStr = append(errStr, fmt.Sprintf("invalid params: %v, only letters, numbers, spaces and [+#.&'-] allowed for keywords and letters, spaces and [.'-] for location", invalid))
 		}
 		_, err := fmt.Fprint(w, strings.Join(errStr, ", "))
 		if err != nil {
@@ -310,6 +683,102 @@ func validateParams(params []string, w http.ResponseWriter, r *http.Request) (ur
 	return valid, nil
 }
 
+// maxFilterTerms is the maximum amount of terms per filter.
+const maxFilterTerms = 10
+
+// validateFilters validates the optional filter params and normalizes their terms.
+// Terms are sorted and deduplicated so the same filters always map to the same query.
+// It must be called after validateParams, which parses the form.
+// If a filter contains invalid terms or too many of them, it will respond with 400.
+func validateFilters(w http.ResponseWriter, r *http.Request) (url.Values, error) {
+	invalid := []string{}
+	valid := url.Values{}
+	for _, p := range []string{queryParamExclude, queryParamTitleInclude, queryParamTitleExclude} {
+		var terms []string
+		for _, v := range r.Form[p] {
+			for t := range strings.SplitSeq(v, ",") {
+				// Filter terms are only compared, so they're stored case folded.
+				if t = jobber.SearchKey(t); t != "" {
+					terms = append(terms, t)
+				}
+			}
+		}
+		slices.Sort(terms)
+		terms = slices.Compact(terms)
+
+		if len(terms) > maxFilterTerms || slices.ContainsFunc(terms, func(t string) bool {
+			return !isValidKeywords.MatchString(t) || !strings.ContainsFunc(t, isAlphanumeric)
+		}) {
+			invalid = append(invalid, p)
+			continue
+		}
+		if len(terms) > 0 {
+			valid[p] = terms
+		}
+	}
+	if len(invalid) != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := fmt.Fprintf(w, "invalid params: %v, up to %d comma separated terms of letters, numbers, spaces and [+#.&'-] allowed for filters", invalid, maxFilterTerms)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write response in validateFilters: %w", err)
+		}
+		return nil, fmt.Errorf("invalid params in validateFilters: %v", invalid)
+	}
+	return valid, nil
+}
+
+// validateSources validates the optional source params against the available
+// scrapers and returns their names, sorted and deduplicated. Sources can be
+// repeated or comma separated and are matched case insensitively.
+// If a source is unknown, it will respond with 400.
+func (s *server) validateSources(w http.ResponseWriter, r *http.Request) ([]string, error) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return nil, fmt.Errorf("unable to parse form in validateSources: %w", err)
+	}
+
+	available := s.jobber.Sources()
+	var sources, unknown []string
+	for _, v := range r.Form[queryParamSource] {
+		for src := range strings.SplitSeq(v, ",") {
+			if src = strings.TrimSpace(src); src == "" {
+				continue
+			}
+			i := slices.IndexFunc(available, func(a string) bool { return strings.EqualFold(a, src) })
+			if i == -1 {
+				unknown = append(unknown, src)
+				continue
+			}
+			sources = append(sources, available[i])
+		}
+	}
+	if len(unknown) != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := fmt.Fprintf(w, "invalid params: [%s], available sources are %v", queryParamSource, available)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write response in validateSources: %w", err)
+		}
+		return nil, fmt.Errorf("unknown sources in validateSources: %v", unknown)
+	}
+	slices.Sort(sources)
+	return slices.Compact(sources), nil
+}
+
+// normalizeParam normalizes a keywords or location value the way it's
+// searched in the job portals. It composes the value into NFC, lowercases
+// it and collapses whitespace. Unlike case folding, lowercasing keeps
+// letters like "ß", so the same search typed differently is told apart
+// by its jobber.SearchKey instead.
+func normalizeParam(v string) string {
+	// Lowercasing can decompose some characters so we compose them back.
+	v = norm.NFC.String(strings.ToLower(norm.NFC.String(v)))
+	return strings.Join(strings.Fields(v), " ")
+}
+
+func isAlphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
 var funcMap = template.FuncMap{
 	"pubDate": func(o *db.Offer) string {
 		return o.PostedAt.Time.Format(time.RFC1123Z)
@@ -317,4 +786,7 @@ var funcMap = template.FuncMap{
 	"postedAt": func(o *db.Offer) string {
 		return o.PostedAt.Time.Format("Jan 2")
 	},
+	"updatedAt": func(o *db.Offer) string {
+		return o.UpdatedAt.Time.Format("Jan 2")
+	},
 }
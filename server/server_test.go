@@ -1,6 +1,8 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -13,8 +15,11 @@ import (
 
 	"github.com/alwedo/jobber/db"
 	"github.com/alwedo/jobber/jobber"
+	"github.com/alwedo/jobber/metrics"
 	"github.com/alwedo/jobber/scrape"
 	approvals "github.com/approvals/go-approval-tests"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func TestServer(t *testing.T) {
@@ -45,18 +50,6 @@ func TestServer(t *testing.T) {
 			wantStatus:     http.StatusOK,
 			wantBodyAssert: "html",
 		},
-		{
-			name:   "query creation timeout",
-			path:   "/feeds",
-			method: http.MethodPost,
-			params: map[string]string{
-				queryParamKeywords: "fluffy dogs",
-				queryParamLocation: "berlin",
-			},
-			wantStatus:     http.StatusOK,
-			jobberOpts:     []jobber.Options{jobber.WithTimeOut(time.Nanosecond)},
-			wantBodyAssert: "html",
-		},
 		{
 			name:   "with missing param keywords",
 			path:   "/feeds",
@@ -72,11 +65,11 @@ func TestServer(t *testing.T) {
 			path:   "/feeds",
 			method: http.MethodPost,
 			params: map[string]string{
-				queryParamKeywords: "golang-",
+				queryParamKeywords: "golang!",
 				queryParamLocation: "berlin",
 			},
 			wantStatus:     http.StatusBadRequest,
-			wantBodyString: "invalid params: [keywords], only [A-Za-z0-9] allowed for keywords and [A-Za-z] for location",
+			wantBodyString: "invalid params: [keywords], only letters, numbers, spaces and [+#.&'-] allowed for keywords and letters, spaces and [.'-] for location",
 		},
 		{
 			name:   "with incorrect param location",
@@ -87,7 +80,7 @@ func TestServer(t *testing.T) {
 				queryParamLocation: "berlin&",
 			},
 			wantStatus:     http.StatusBadRequest,
-			wantBodyString: "invalid params: [location], only [A-Za-z0-9] allowed for keywords and [A-Za-z] for location",
+			wantBodyString: "invalid params: [location], only letters, numbers, spaces and [+#.&'-] allowed for keywords and letters, spaces and [.'-] for location",
 		},
 		{
 			name:   "with param location as numbers",
@@ -98,7 +91,7 @@ func TestServer(t *testing.T) {
 				queryParamLocation: "123",
 			},
 			wantStatus:     http.StatusBadRequest,
-			wantBodyString: "invalid params: [location], only [A-Za-z0-9] allowed for keywords and [A-Za-z] for location",
+			wantBodyString: "invalid params: [location], only letters, numbers, spaces and [+#.&'-] allowed for keywords and letters, spaces and [.'-] for location",
 		},
 		{
 			name:   "with missing param location",
@@ -115,10 +108,57 @@ func TestServer(t *testing.T) {
 			path:   "/feeds",
 			method: http.MethodPost,
 			params: map[string]string{
-				queryParamLocation: "the-moon",
+				queryParamLocation: "the moon?",
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantBodyString: "missing params: [keywords], invalid params: [location], only letters, numbers, spaces and [+#.&'-] allowed for keywords and letters, spaces and [.'-] for location",
+		},
+		{
+			name:   "with filters",
+			path:   "/feeds",
+			method: http.MethodPost,
+			params: map[string]string{
+				queryParamKeywords:     "golang",
+				queryParamLocation:     "berlin",
+				queryParamExclude:      "werkstudent, recruiter",
+				queryParamTitleExclude: "sales",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "with invalid filters",
+			path:   "/feeds",
+			method: http.MethodPost,
+			params: map[string]string{
+				queryParamKeywords:     "golang",
+				queryParamLocation:     "berlin",
+				queryParamTitleInclude: "backend, <script>",
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantBodyString: "invalid params: [title_include], up to 10 comma separated terms of letters, numbers, spaces and [+#.&'-] allowed for filters",
+		},
+		{
+			name:   "with sources",
+			path:   "/feeds",
+			method: http.MethodPost,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+				queryParamSource:   "mock",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "with unknown sources",
+			path:   "/feeds",
+			method: http.MethodPost,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+				queryParamSource:   "mock, monster",
 			},
 			wantStatus:     http.StatusBadRequest,
-			wantBodyString: "missing params: [keywords], invalid params: [location], only [A-Za-z0-9] allowed for keywords and [A-Za-z] for location",
+			wantBodyString: "invalid params: [source], available sources are [Mock]",
 		},
 		{
 			name:   "with exceeding data on form",
@@ -162,6 +202,58 @@ func TestServer(t *testing.T) {
 				"Cache-Control": "",
 			},
 		},
+		{
+			name:   "valid Atom feed",
+			path:   "/feeds",
+			method: http.MethodGet,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+			},
+			headers:        map[string]string{"Accept": "application/atom+xml"},
+			wantStatus:     http.StatusOK,
+			wantHeaders:    map[string]string{"Content-Type": "application/atom+xml"},
+			wantBodyAssert: "xml",
+		},
+		{
+			name:   "valid Atom feed with format param",
+			path:   "/feeds",
+			method: http.MethodGet,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+				queryParamFormat:   formatAtom,
+			},
+			wantStatus:     http.StatusOK,
+			wantHeaders:    map[string]string{"Content-Type": "application/atom+xml"},
+			wantBodyAssert: "xml",
+		},
+		{
+			name:   "valid JSON feed",
+			path:   "/feeds",
+			method: http.MethodGet,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+			},
+			headers:        map[string]string{"Accept": "application/feed+json"},
+			wantStatus:     http.StatusOK,
+			wantHeaders:    map[string]string{"Content-Type": "application/feed+json"},
+			wantBodyAssert: "json",
+		},
+		{
+			name:   "valid NDJSON export",
+			path:   "/feeds",
+			method: http.MethodGet,
+			params: map[string]string{
+				queryParamKeywords: "golang",
+				queryParamLocation: "berlin",
+				queryParamFormat:   formatNDJSON,
+			},
+			wantStatus:     http.StatusOK,
+			wantHeaders:    map[string]string{"Content-Type": "application/x-ndjson"},
+			wantBodyAssert: "ndjson",
+		},
 		{
 			name:   "invalid XML feed",
 			path:   "/feeds",
@@ -214,6 +306,13 @@ func TestServer(t *testing.T) {
 			wantStatus:     http.StatusOK,
 			wantBodyAssert: "html",
 		},
+		{
+			name:           "status page",
+			path:           "/status",
+			method:         http.MethodGet,
+			wantStatus:     http.StatusOK,
+			wantBodyAssert: "html",
+		},
 		{
 			name:           "index page",
 			path:           "/",
@@ -364,12 +463,673 @@ func TestServer(t *testing.T) {
 	}
 }
 
-// Scrubs dates, times and server ports
+// Scrubs dates, times, server ports and feed ids
 func scroobbyDoobyDoo(s string) string {
 	s = regexp.MustCompile(`<pubDate>[^<]*</pubDate>`).ReplaceAllString(s, `<pubDate>DATETIME_SCRUBBED</pubDate>`)
 	s = regexp.MustCompile(`<b>Posted:</b>[^<]*</li>`).ReplaceAllString(s, `<b>Posted:</b>DATETIME_SCRUBBED</li>`)
 	s = regexp.MustCompile(`<td>\s*[A-Za-z]{3}\s+\d{1,2}\s*</td>`).ReplaceAllString(s, `<td>DATE_SCRUBBED</td>`)
 	s = regexp.MustCompile(`<b>Posted</b>:\s*[A-Za-z]{3}\s+\d{1,2}<br>`).ReplaceAllString(s, `<b>Posted</b>: DATE_SCRUBBED<br>`)
+	s = regexp.MustCompile(`<updated>[^<]*</updated>`).ReplaceAllString(s, `<updated>DATETIME_SCRUBBED</updated>`)
+	s = regexp.MustCompile(`<published>[^<]*</published>`).ReplaceAllString(s, `<published>DATETIME_SCRUBBED</published>`)
+	s = regexp.MustCompile(`"(date_published|date_modified|posted_at|created_at|first_seen_at|last_seen_at|updated_at)":"[^"]*"`).ReplaceAllString(s, `"$1":"DATETIME_SCRUBBED"`)
 	s = regexp.MustCompile(`127\.0\.0\.1:\d+`).ReplaceAllString(s, `127.0.0.1:PORT_SCRUBBED`)
+	s = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`).ReplaceAllString(s, `UUID_SCRUBBED`)
 	return s
 }
+
+func TestConditionalGET(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := jobber.New(t.Context(), l, d, jobber.WithScrapeList(scrape.MockList))
+	defer jCloser()
+	svr, err := New(l, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(svr.Handler)
+	defer server.Close()
+
+	get := func(t *testing.T, url string, headers map[string]string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("unable to create http request: %v", err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unable to perform http request: %v", err)
+		}
+		defer r.Body.Close()
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			t.Fatalf("unable to read response body: %v", err)
+		}
+		return r
+	}
+
+	// The legacy url redirects to the feed's stable url.
+	first := get(t, server.URL+"/feeds?keywords=golang&location=berlin", nil)
+	feed := first.Request.URL.String()
+	etag := first.Header.Get("ETag")
+	lastModified := first.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("wanted ETag and Last-Modified headers, got %q and %q", etag, lastModified)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "matching If-None-Match",
+			url:        feed,
+			headers:    map[string]string{"If-None-Match": etag},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "matching weak If-None-Match",
+			url:        feed,
+			headers:    map[string]string{"If-None-Match": `"cuak", W/` + etag},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "If-Modified-Since equal to Last-Modified",
+			url:        feed,
+			headers:    map[string]string{"If-Modified-Since": lastModified},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name: "non matching If-None-Match takes precedence over If-Modified-Since",
+			url:  feed,
+			headers: map[string]string{
+				"If-None-Match":     `"cuak"`,
+				"If-Modified-Since": lastModified,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "same ETag for a different representation",
+			url:        feed + ".atom",
+			headers:    map[string]string{"If-None-Match": etag},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := get(t, tt.url, tt.headers)
+			if r.StatusCode != tt.wantStatus {
+				t.Errorf("wanted status code %d, got %d", tt.wantStatus, r.StatusCode)
+			}
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := jobber.New(t.Context(), l, d, jobber.WithScrapeList(scrape.MockList))
+	defer jCloser()
+	svr, err := New(l, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(svr.Handler)
+	defer server.Close()
+
+	get := func(t *testing.T, path string) (int, string) {
+		t.Helper()
+		r, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unable to perform http request: %v", err)
+		}
+		defer r.Body.Close()
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("unable to read response body: %v", err)
+		}
+		return r.StatusCode, string(b)
+	}
+
+	q, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cuak", Location: "squeek"})
+	if err != nil {
+		t.Fatalf("unable to create query: %v", err)
+	}
+	path := progressPath(q.PublicID)
+
+	t.Run("it reports the scrapers state until they finish", func(t *testing.T) {
+		var body string
+		for range 20 {
+			var status int
+			status, body = get(t, path)
+			if status != http.StatusOK {
+				t.Fatalf("wanted status code %d, got %d", http.StatusOK, status)
+			}
+			if !strings.Contains(body, "hx-trigger") {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if !strings.Contains(body, "<b>Mock</b>: done with 1 offers") {
+			t.Errorf("wanted the Mock scraper to be done, got %s", body)
+		}
+	})
+
+	t.Run("unknown query", func(t *testing.T) {
+		if status, _ := get(t, "/f/"+uuid.NewString()+"/progress"); status != http.StatusNotFound {
+			t.Errorf("wanted status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("feed extensions aren't progress urls", func(t *testing.T) {
+		if status, _ := get(t, "/f/"+uuid.UUID(q.PublicID.Bytes).String()+".rss/progress"); status != http.StatusNotFound {
+			t.Errorf("wanted status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+func TestRuns(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := jobber.New(t.Context(), l, d, jobber.WithScrapeList(scrape.MockList))
+	defer jCloser()
+	svr, err := New(l, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(svr.Handler)
+	defer server.Close()
+
+	q, err := j.CreateQuery(t.Context(), &db.CreateQueryParams{Keywords: "cuak", Location: "squeek"})
+	if err != nil {
+		t.Fatalf("unable to create query: %v", err)
+	}
+	path := "/f/" + uuid.UUID(q.PublicID.Bytes).String() + "/runs"
+
+	t.Run("it lists the query runs", func(t *testing.T) {
+		var got jsonRuns
+		for range 20 {
+			r, err := http.Get(server.URL + path)
+			if err != nil {
+				t.Fatalf("unable to perform http request: %v", err)
+			}
+			if r.StatusCode != http.StatusOK {
+				t.Fatalf("wanted status code %d, got %d", http.StatusOK, r.StatusCode)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("wanted content type application/json, got %s", ct)
+			}
+			err = json.NewDecoder(r.Body).Decode(&got)
+			r.Body.Close()
+			if err != nil {
+				t.Fatalf("unable to decode response body: %v", err)
+			}
+			if len(got.Runs) > 0 {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if got.Keywords != "cuak" || len(got.Runs) != 1 {
+			t.Fatalf("wanted a single run of the query, got %+v", got)
+		}
+		if run := got.Runs[0]; run.Scraper != "Mock" || run.Pages != 1 || run.Offers != 1 || run.NewOffers != 1 || run.Error != "" {
+			t.Errorf("wanted a successful Mock run with 1 new offer, got %+v", run)
+		}
+	})
+
+	t.Run("unknown query", func(t *testing.T) {
+		r, err := http.Get(server.URL + "/f/" + uuid.NewString() + "/runs")
+		if err != nil {
+			t.Fatalf("unable to perform http request: %v", err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusNotFound {
+			t.Errorf("wanted status code %d, got %d", http.StatusNotFound, r.StatusCode)
+		}
+	})
+}
+
+func TestFeedRoutes(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	d, dbCloser := db.NewTestDB(t)
+	defer dbCloser()
+	j, jCloser := jobber.New(t.Context(), l, d, jobber.WithScrapeList(scrape.MockList))
+	defer jCloser()
+	svr, err := New(l, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(svr.Handler)
+	defer server.Close()
+
+	q, err := j.GetQuery(t.Context(), &db.GetQueryParams{KeywordsKey: "golang", LocationKey: "berlin"})
+	if err != nil {
+		t.Fatalf("unable to get query: %v", err)
+	}
+	feed := "/f/" + uuid.UUID(q.PublicID.Bytes).String()
+
+	// We don't follow redirects so we can assert them.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantType     string
+	}{
+		{
+			name:         "legacy url redirects",
+			path:         "/feeds?keywords=golang&location=berlin",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: feed,
+		},
+		{
+			name:         "legacy url redirects keeping the format",
+			path:         "/feeds?keywords=golang&location=berlin&format=atom",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: feed + ".atom",
+		},
+		{
+			name:         "legacy url redirects keeping the sources",
+			path:         "/feeds?keywords=golang&location=berlin&format=rss&source=Mock",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: feed + ".rss?source=Mock",
+		},
+		{
+			name:       "legacy url of non existent query",
+			path:       "/feeds?keywords=fluffy+dogs&location=the+moon",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "feed",
+			path:       feed,
+			wantStatus: http.StatusOK,
+			wantType:   "application/rss+xml",
+		},
+		{
+			name:       "feed with rss extension",
+			path:       feed + ".rss",
+			wantStatus: http.StatusOK,
+			wantType:   "application/rss+xml",
+		},
+		{
+			name:       "feed with atom extension",
+			path:       feed + ".atom",
+			wantStatus: http.StatusOK,
+			wantType:   "application/atom+xml",
+		},
+		{
+			name:       "feed with source",
+			path:       feed + ".atom?source=mock",
+			wantStatus: http.StatusOK,
+			wantType:   "application/atom+xml",
+		},
+		{
+			name:       "feed with unknown source",
+			path:       feed + "?source=monster",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "feed with unknown extension",
+			path:       feed + ".pdf",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "feed with invalid id",
+			path:       "/f/cuak.rss",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "non existent feed",
+			path:       "/f/" + uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := client.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("unable to perform http request: %v", err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != tt.wantStatus {
+				t.Errorf("wanted status code %d, got %d", tt.wantStatus, r.StatusCode)
+			}
+			if got := r.Header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("wanted location %q, got %q", tt.wantLocation, got)
+			}
+			if tt.wantType != "" && r.Header.Get("Content-Type") != tt.wantType {
+				t.Errorf("wanted content type %s, got %s", tt.wantType, r.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestParseFeedID(t *testing.T) {
+	id := "3f1c2d4e-5b6a-4c7d-8e9f-0a1b2c3d4e5f"
+	tests := []struct {
+		name    string
+		in      string
+		wantExt string
+		wantErr bool
+	}{
+		{name: "id", in: id},
+		{name: "id with rss extension", in: id + ".rss", wantExt: formatRSS},
+		{name: "id with ndjson extension", in: id + ".ndjson", wantExt: formatNDJSON},
+		{name: "unknown extension", in: id + ".xml", wantErr: true},
+		{name: "non canonical id", in: "urn:uuid:" + id, wantErr: true},
+		{name: "invalid id", in: "cuak", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ext, err := parseFeedID(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %t, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ext != tt.wantExt {
+				t.Errorf("wanted extension %q, got %q", tt.wantExt, ext)
+			}
+			if uuid.UUID(got.Bytes).String() != id {
+				t.Errorf("wanted id %s, got %s", id, uuid.UUID(got.Bytes).String())
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		proto  string
+		want   string
+	}{
+		{name: "behind the proxy", target: "http://rssjobs.app/feeds", want: "https://rssjobs.app"},
+		{name: "forwarded http", target: "http://rssjobs.app/feeds", proto: "http", want: "http://rssjobs.app"},
+		{name: "forwarded https", target: "http://localhost/feeds", proto: "https", want: "https://localhost"},
+		{name: "tls", target: "https://localhost:8443/feeds", want: "https://localhost:8443"},
+		{name: "localhost", target: "http://localhost:8080/feeds", want: "http://localhost:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := baseURL(r).String(); got != tt.want {
+				t.Errorf("wanted base url %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		keywords     string
+		location     string
+		wantKeywords string
+		wantLocation string
+		wantStatus   int
+	}{
+		{name: "ascii", keywords: "Golang", location: "Berlin", wantKeywords: "golang", wantLocation: "berlin"},
+		{name: "umlauts", keywords: "Entwickler", location: "München", wantKeywords: "entwickler", wantLocation: "münchen"},
+		{name: "decomposed umlauts are composed", keywords: "golang", location: "Du\u0308sseldorf", wantKeywords: "golang", wantLocation: "düsseldorf"},
+		{name: "plus signs", keywords: "C++", location: "berlin", wantKeywords: "c++", wantLocation: "berlin"},
+		{name: "hash", keywords: "C# developer", location: "berlin", wantKeywords: "c# developer", wantLocation: "berlin"},
+		{name: "leading dot", keywords: ".NET", location: "berlin", wantKeywords: ".net", wantLocation: "berlin"},
+		{name: "multi word location", keywords: "golang", location: "Frankfurt am Main", wantKeywords: "golang", wantLocation: "frankfurt am main"},
+		{name: "hyphenated location", keywords: "golang", location: "Saint-Denis", wantKeywords: "golang", wantLocation: "saint-denis"},
+		{name: "whitespace is collapsed", keywords: "  senior\t golang ", location: "new \u00a0 york", wantKeywords: "senior golang", wantLocation: "new york"},
+		{name: "case folding", keywords: "ΣΊΣΥΦΟΣ", location: "berlin", wantKeywords: "σίσυφοσ", wantLocation: "berlin"},
+		{name: "sharp s is kept", keywords: "Straßenbau", location: "Gießen", wantKeywords: "straßenbau", wantLocation: "gießen"},
+		{name: "only punctuation", keywords: "++", location: "berlin", wantStatus: http.StatusBadRequest},
+		{name: "disallowed punctuation", keywords: "golang", location: "berlin/brandenburg", wantStatus: http.StatusBadRequest},
+		{name: "numbers in location", keywords: "golang", location: "berlin 10115", wantStatus: http.StatusBadRequest},
+		{name: "only whitespace", keywords: "golang", location: " \t ", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qp := url.Values{}
+			qp.Add(queryParamKeywords, tt.keywords)
+			qp.Add(queryParamLocation, tt.location)
+			r := httptest.NewRequest(http.MethodGet, "/feeds?"+qp.Encode(), nil)
+			w := httptest.NewRecorder()
+
+			got, err := validateParams([]string{queryParamKeywords, queryParamLocation}, w, r)
+			if tt.wantStatus != 0 {
+				if err == nil {
+					t.Fatalf("wanted an error, got params %v", got)
+				}
+				if w.Code != tt.wantStatus {
+					t.Errorf("wanted status code %d, got %d", tt.wantStatus, w.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("wanted no error, got %v", err)
+			}
+			if got.Get(queryParamKeywords) != tt.wantKeywords {
+				t.Errorf("wanted keywords %q, got %q", tt.wantKeywords, got.Get(queryParamKeywords))
+			}
+			if got.Get(queryParamLocation) != tt.wantLocation {
+				t.Errorf("wanted location %q, got %q", tt.wantLocation, got.Get(queryParamLocation))
+			}
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       url.Values
+		want       url.Values
+		wantStatus int
+	}{
+		{
+			name: "no filters",
+			form: url.Values{},
+			want: url.Values{},
+		},
+		{
+			name: "empty filters",
+			form: url.Values{queryParamExclude: {""}, queryParamTitleInclude: {" , "}},
+			want: url.Values{},
+		},
+		{
+			name: "terms are normalized, sorted and deduplicated",
+			form: url.Values{
+				queryParamExclude:      {"Recruiter, Werkstudent", "werkstudent"},
+				queryParamTitleInclude: {"Backend,  C++ ", "Straßenbau"},
+			},
+			want: url.Values{
+				queryParamExclude:      {"recruiter", "werkstudent"},
+				queryParamTitleInclude: {"backend", "c++", "strassenbau"},
+			},
+		},
+		{
+			name:       "invalid term",
+			form:       url.Values{queryParamTitleExclude: {"sales, <script>"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "only punctuation",
+			form:       url.Values{queryParamTitleExclude: {"++"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too many terms",
+			form:       url.Values{queryParamExclude: {"a,b,c,d,e,f,g,h,i,j,k"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feeds?"+tt.form.Encode(), nil)
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+
+			got, err := validateFilters(w, r)
+			if tt.wantStatus != 0 {
+				if err == nil {
+					t.Fatalf("wanted an error, got filters %v", got)
+				}
+				if w.Code != tt.wantStatus {
+					t.Errorf("wanted status code %d, got %d", tt.wantStatus, w.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("wanted no error, got %v", err)
+			}
+			if got.Encode() != tt.want.Encode() {
+				t.Errorf("wanted filters %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2025, time.November, 13, 10, 0, 0, 500, time.UTC)
+	etag := `"abc"`
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no conditional headers"},
+		{name: "matching etag", headers: map[string]string{"If-None-Match": `"abc"`}, want: true},
+		{name: "matching weak etag", headers: map[string]string{"If-None-Match": `W/"abc"`}, want: true},
+		{name: "matching etag in a list", headers: map[string]string{"If-None-Match": `"cuak", "abc"`}, want: true},
+		{name: "wildcard etag", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "non matching etag", headers: map[string]string{"If-None-Match": `"cuak"`}},
+		{
+			name:    "modified since",
+			headers: map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+		},
+		{
+			name:    "not modified since",
+			headers: map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			want:    true,
+		},
+		{
+			name:    "invalid If-Modified-Since",
+			headers: map[string]string{"If-Modified-Since": "yesterday"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feeds", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := notModified(r, etag, lastModified); got != tt.want {
+				t.Errorf("wanted %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+// brokenWriter fails every write after the first one, like a client
+// disconnecting in the middle of a response.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+	status []int
+}
+
+func (w *brokenWriter) WriteHeader(code int) {
+	w.status = append(w.status, code)
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func (w *brokenWriter) Write(b []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("cuak")
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	s := &server{logger: l}
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	pages := func(yield func([]*db.Offer, error) bool) {
+		_ = yield([]*db.Offer{
+			{ID: 7, ExternalID: "cuak", Source: "LinkedIn", GroupID: pgtype.Int8{Int64: 3, Valid: true}, CheckedAt: now, ClosedAt: now},
+			{ID: 8, ExternalID: "squeek", Source: "Stepstone"},
+		}, nil) && yield([]*db.Offer{{ID: 9, ExternalID: "quack", Source: "Glassdoor"}}, nil)
+	}
+
+	t.Run("full offer rows", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.streamNDJSON(w, pages)
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("wanted 3 lines, got %d", len(lines))
+		}
+		var got map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+			t.Fatalf("unable to decode offer: %v", err)
+		}
+		for _, k := range []string{"internal_id", "group_id", "checked_at", "closed_at"} {
+			if _, ok := got[k]; !ok {
+				t.Errorf("wanted %s in %s", k, lines[0])
+			}
+		}
+	})
+
+	t.Run("write errors after the first offer", func(t *testing.T) {
+		w := &brokenWriter{ResponseRecorder: httptest.NewRecorder()}
+		s.streamNDJSON(w, pages)
+		if len(w.status) != 0 {
+			t.Errorf("wanted no status to be written after the first offer, got %v", w.status)
+		}
+		if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 1 {
+			t.Errorf("wanted only the first offer, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("listing errors before the first offer", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.streamNDJSON(w, func(yield func([]*db.Offer, error) bool) {
+			yield(nil, errors.New("cuak"))
+		})
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("wanted status %d, got %d", http.StatusInternalServerError, w.Code)
+		}
+	})
+
+	t.Run("pages are flushed through the metrics middleware", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h := metrics.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			s.streamNDJSON(w, pages)
+		}))
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/f/cuak.ndjson", http.NoBody))
+		if !w.Flushed {
+			t.Error("wanted the response to be flushed")
+		}
+	})
+}
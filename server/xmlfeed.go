@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alwedo/jobber/jobber"
+)
+
+const (
+	rssVersion    = "2.0"
+	atomNamespace = "http://www.w3.org/2005/Atom"
+	// atomTagDate is the date of the tag URIs identifying the Atom entries.
+	// It must not change or readers will take every entry for a new one.
+	// See https://www.rfc-editor.org/rfc/rfc4151
+	atomTagDate = "2026"
+)
+
+// cdata wraps a string so encoding/xml writes it as a CDATA section.
+// It's used for the HTML offer descriptions so readers can render them.
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// RSS 2.0 feed. See https://www.rssboard.org/rss-specification
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description cdata   `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Atom 1.0 feed. See https://www.rfc-editor.org/rfc/rfc4287
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Links    []atomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Author   atomPerson  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	Link      atomLink    `xml:"link"`
+	ID        string      `xml:"id"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",cdata"`
+}
+
+func (s *server) newRSS(d *feedData) (*rss, error) {
+	title := d.Keywords + " jobs in " + d.Location
+	f := &rss{
+		Version: rssVersion,
+		Channel: rssChannel{
+			Title:       title,
+			Link:        d.HomeURL,
+			Description: title,
+			Items:       make([]rssItem, 0, len(d.Offers)),
+		},
+	}
+	for _, o := range d.Offers {
+		desc, err := s.offerDescription(o)
+		if err != nil {
+			return nil, err
+		}
+		f.Channel.Items = append(f.Channel.Items, rssItem{
+			Title:       offerTitle(o.Offer),
+			Link:        o.Url,
+			Description: cdata{desc},
+			PubDate:     o.FirstSeenAt.Time.Format(time.RFC1123Z),
+			GUID:        rssGUID{Value: offerGUID(o.Offer)},
+		})
+	}
+	return f, nil
+}
+
+func (s *server) newAtom(d *feedData) (*atomFeed, error) {
+	title := d.Keywords + " jobs in " + d.Location
+	f := &atomFeed{
+		Xmlns:    atomNamespace,
+		Title:    title,
+		Subtitle: title,
+		ID:       "urn:uuid:" + d.ID,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: d.URL + "." + formatAtom},
+			{Rel: "alternate", Type: "text/html", Href: d.HomeURL},
+		},
+		Updated: d.UpdatedAt.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: "rssjobs"},
+		Entries: make([]atomEntry, 0, len(d.Offers)),
+	}
+	for _, o := range d.Offers {
+		desc, err := s.offerDescription(o)
+		if err != nil {
+			return nil, err
+		}
+		updated := o.FirstSeenAt
+		if o.UpdatedAt.Valid {
+			updated = o.UpdatedAt
+		}
+		f.Entries = append(f.Entries, atomEntry{
+			Title:     offerTitle(o.Offer),
+			Link:      atomLink{Rel: "alternate", Href: o.Url},
+			ID:        "tag:" + d.Hostname + "," + atomTagDate + ":offer:" + offerGUID(o.Offer),
+			Published: o.FirstSeenAt.Time.UTC().Format(time.RFC3339),
+			Updated:   updated.Time.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: o.Company},
+			Content:   atomContent{Type: "html", Value: desc},
+		})
+	}
+	return f, nil
+}
+
+// offerDescription renders the HTML description of an offer
+// shared by the RSS and Atom feeds. Scraped values are escaped
+// by html/template before being wrapped in a CDATA section.
+func (s *server) offerDescription(o *jobber.Offer) (string, error) {
+	var b bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&b, tmplOfferDescription, o); err != nil {
+		return "", fmt.Errorf("failed to execute offer description template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// writeXML writes the XML header followed by the indented encoding of v.
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alwedo/jobber/db"
+	"github.com/alwedo/jobber/jobber"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestXMLFeeds(t *testing.T) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{templates: tmpl}
+	d := newTestFeedData()
+
+	t.Run("RSS is valid RSS 2.0", func(t *testing.T) {
+		f, err := s.newRSS(d)
+		if err != nil {
+			t.Fatalf("failed to build RSS: %v", err)
+		}
+		var b bytes.Buffer
+		if err := writeXML(&b, f); err != nil {
+			t.Fatalf("failed to write RSS: %v", err)
+		}
+		validateRSS(t, b.Bytes(), len(d.Offers))
+
+		for _, unescaped := range []string{"R&D", "<m/w/d>", "<script>"} {
+			if strings.Contains(b.String(), unescaped) {
+				t.Errorf("wanted %q to be escaped, got:\n%s", unescaped, b.String())
+			}
+		}
+	})
+
+	t.Run("Atom is well formed", func(t *testing.T) {
+		f, err := s.newAtom(d)
+		if err != nil {
+			t.Fatalf("failed to build Atom: %v", err)
+		}
+		var b bytes.Buffer
+		if err := writeXML(&b, f); err != nil {
+			t.Fatalf("failed to write Atom: %v", err)
+		}
+		got := &atomFeed{}
+		if err := xml.Unmarshal(b.Bytes(), got); err != nil {
+			t.Fatalf("invalid Atom XML: %v", err)
+		}
+		if got.XMLName.Space != atomNamespace {
+			t.Errorf("wanted namespace %s, got %s", atomNamespace, got.XMLName.Space)
+		}
+		if len(got.Entries) != len(d.Offers) {
+			t.Fatalf("wanted %d entries, got %d", len(d.Offers), len(got.Entries))
+		}
+		if got.Entries[0].Title != d.Offers[0].Title+" at "+d.Offers[0].Company {
+			t.Errorf("wanted title to round trip, got %s", got.Entries[0].Title)
+		}
+		// Entry ids must be IRIs, see https://www.rfc-editor.org/rfc/rfc4151
+		if want := "tag:localhost,2026:offer:stepstone:1"; got.Entries[0].ID != want {
+			t.Errorf("wanted entry id %s, got %s", want, got.Entries[0].ID)
+		}
+		if got.Links[1].Href != d.HomeURL {
+			t.Errorf("wanted alternate link %s, got %s", d.HomeURL, got.Links[1].Href)
+		}
+	})
+
+	t.Run("HTML feed escapes scraped values", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := s.templates.ExecuteTemplate(&b, tmplFeedHTML, d); err != nil {
+			t.Fatalf("failed to execute template: %v", err)
+		}
+		if strings.Contains(b.String(), "<script>") {
+			t.Errorf("wanted scraped <script> to be escaped, got:\n%s", b.String())
+		}
+	})
+
+	t.Run("updated offers are marked and keep their first seen date", func(t *testing.T) {
+		o := d.Offers[1]
+		r, err := s.newRSS(d)
+		if err != nil {
+			t.Fatalf("failed to build RSS: %v", err)
+		}
+		item := r.Channel.Items[1]
+		if !strings.HasSuffix(item.Title, "(updated)") {
+			t.Errorf("wanted RSS title to be marked as updated, got %s", item.Title)
+		}
+		if want := o.FirstSeenAt.Time.Format(time.RFC1123Z); item.PubDate != want {
+			t.Errorf("wanted RSS pubDate %s, got %s", want, item.PubDate)
+		}
+		if strings.Contains(r.Channel.Items[0].Title, "(updated)") {
+			t.Errorf("wanted RSS title not to be marked as updated, got %s", r.Channel.Items[0].Title)
+		}
+
+		a, err := s.newAtom(d)
+		if err != nil {
+			t.Fatalf("failed to build Atom: %v", err)
+		}
+		entry := a.Entries[1]
+		if want := o.FirstSeenAt.Time.UTC().Format(time.RFC3339); entry.Published != want {
+			t.Errorf("wanted Atom published %s, got %s", want, entry.Published)
+		}
+		if want := o.UpdatedAt.Time.UTC().Format(time.RFC3339); entry.Updated != want {
+			t.Errorf("wanted Atom updated %s, got %s", want, entry.Updated)
+		}
+	})
+
+	t.Run("duplicated offers link to every source", func(t *testing.T) {
+		desc, err := s.offerDescription(d.Offers[0])
+		if err != nil {
+			t.Fatalf("failed to render description: %v", err)
+		}
+		var b bytes.Buffer
+		if err := s.templates.ExecuteTemplate(&b, tmplFeedHTML, d); err != nil {
+			t.Fatalf("failed to execute template: %v", err)
+		}
+		for _, got := range []string{desc, b.String()} {
+			for _, want := range []string{"https://www.stepstone.de/r-and-d?a=1&amp;b=2", "https://www.glassdoor.de/job-listing/r-and-d?jl=3&amp;a=1"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("wanted link %s, got:\n%s", want, got)
+				}
+			}
+		}
+	})
+}
+
+// validateRSS checks the document against the RSS 2.0 specification.
+// See https://www.rssboard.org/rss-specification
+func validateRSS(t *testing.T, doc []byte, wantItems int) {
+	t.Helper()
+
+	got := &rss{}
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.Strict = true
+	if err := dec.Decode(got); err != nil {
+		t.Fatalf("RSS is not well formed XML: %v", err)
+	}
+
+	if got.XMLName.Local != "rss" {
+		t.Errorf("wanted root element rss, got %s", got.XMLName.Local)
+	}
+	if got.Version != "2.0" {
+		t.Errorf("wanted version attribute 2.0, got %q", got.Version)
+	}
+
+	// Required channel elements.
+	c := got.Channel
+	if c.Title == "" || c.Link == "" || c.Description == "" {
+		t.Errorf("wanted channel title, link and description, got %+v", c)
+	}
+	if !isAbsoluteURL(c.Link) {
+		t.Errorf("wanted channel link to be an absolute URL, got %s", c.Link)
+	}
+
+	if len(c.Items) != wantItems {
+		t.Fatalf("wanted %d items, got %d", wantItems, len(c.Items))
+	}
+	guids := make(map[string]bool, len(c.Items))
+	for i, item := range c.Items {
+		// At least one of title or description must be present.
+		if item.Title == "" && item.Description.Value == "" {
+			t.Errorf("item %d: wanted title or description", i)
+		}
+		if item.Link != "" && !isAbsoluteURL(item.Link) {
+			t.Errorf("item %d: wanted link to be an absolute URL, got %s", i, item.Link)
+		}
+		// Dates must conform to RFC 822.
+		if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+			t.Errorf("item %d: wanted RFC 822 pubDate, got %s: %v", i, item.PubDate, err)
+		}
+		if item.GUID.Value == "" {
+			t.Errorf("item %d: wanted guid", i)
+		}
+		if item.GUID.IsPermaLink && !isAbsoluteURL(item.GUID.Value) {
+			t.Errorf("item %d: wanted permalink guid to be an absolute URL, got %s", i, item.GUID.Value)
+		}
+		if guids[item.GUID.Value] {
+			t.Errorf("item %d: wanted unique guid, got duplicated %s", i, item.GUID.Value)
+		}
+		guids[item.GUID.Value] = true
+	}
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
+
+func newTestFeedData() *feedData {
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	return &feedData{
+		ID:        "3f1c2d4e-5b6a-4c7d-8e9f-0a1b2c3d4e5f",
+		Keywords:  "r&d",
+		Location:  "berlin",
+		Hostname:  "localhost",
+		HomeURL:   "http://localhost",
+		URL:       "http://localhost/f/3f1c2d4e-5b6a-4c7d-8e9f-0a1b2c3d4e5f",
+		UpdatedAt: now.Time,
+		Offers: []*jobber.Offer{
+			{
+				Offer: &db.Offer{
+					ExternalID:  "1",
+					Title:       "R&D Engineer <m/w/d>",
+					Company:     "Späti GmbH",
+					Location:    "Berlin",
+					PostedAt:    now,
+					FirstSeenAt: now,
+					Source:      "Stepstone",
+					Url:         "https://www.stepstone.de/r-and-d?a=1&b=2",
+					Description: "<script>alert(1)</script> ]]> breaking out of CDATA",
+				},
+				Duplicates: []*db.Offer{
+					{
+						ExternalID: "3",
+						Title:      "R&D Engineer",
+						Company:    "Späti",
+						Location:   "Berlin",
+						PostedAt:   now,
+						Source:     "Glassdoor",
+						Url:        "https://www.glassdoor.de/job-listing/r-and-d?jl=3&a=1",
+					},
+				},
+			},
+			{
+				Offer: &db.Offer{
+					// Portals' ids can collide, guids must not.
+					ExternalID:  "1",
+					Title:       "Junior Golang Dweeb",
+					Company:     "Späti GmbH",
+					Location:    "Berlin",
+					PostedAt:    now,
+					FirstSeenAt: pgtype.Timestamptz{Time: now.Time.AddDate(0, 0, -2), Valid: true},
+					UpdatedAt:   now,
+					Source:      "LinkedIn",
+					Url:         "https://www.linkedin.com/jobs/view/2",
+				},
+			},
+		},
+	}
+}